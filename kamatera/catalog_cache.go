@@ -0,0 +1,47 @@
+package kamatera
+
+import (
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// catalogCache holds responses of catalog endpoints (datacenters, images) for the lifetime of a provider
+// instance. Concurrent requests for the same path share a single API call.
+type catalogCache struct {
+	group   singleflight.Group
+	mu      sync.Mutex
+	results map[string]interface{}
+}
+
+func newCatalogCache() *catalogCache {
+	return &catalogCache{results: map[string]interface{}{}}
+}
+
+// cachedRequest makes a GET request to a catalog endpoint, reusing previous responses for the same path.
+// Failed requests are not cached. The response is shared between callers and must not be modified.
+func cachedRequest(provider *ProviderConfig, path string) (interface{}, error) {
+	if provider == nil || provider.catalogCache == nil {
+		return mockableRequest(provider, "GET", path, nil)
+	}
+	cache := provider.catalogCache
+
+	cache.mu.Lock()
+	result, ok := cache.results[path]
+	cache.mu.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	result, err, _ := cache.group.Do(path, func() (interface{}, error) {
+		result, err := mockableRequest(provider, "GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+		cache.mu.Lock()
+		cache.results[path] = result
+		cache.mu.Unlock()
+		return result, nil
+	})
+	return result, err
+}
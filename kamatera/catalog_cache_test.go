@@ -0,0 +1,58 @@
+package kamatera
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_cachedRequest(t *testing.T) {
+	var called int32
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		atomic.AddInt32(&called, 1)
+		if path == "error" {
+			return nil, errors.New("request failed")
+		}
+		time.Sleep(50 * time.Millisecond)
+		return []interface{}{path}, nil
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	provider := &ProviderConfig{catalogCache: newCatalogCache()}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := cachedRequest(provider, "service/server?datacenter=1")
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"service/server?datacenter=1"}, result)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&called))
+
+	_, err := cachedRequest(provider, "service/server?datacenter=1")
+	assert.NoError(t, err)
+	_, err = cachedRequest(provider, "service/server?images=1&datacenter=EU")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&called))
+
+	for i := 0; i < 2; i++ {
+		_, err = cachedRequest(provider, "error")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, int32(4), atomic.LoadInt32(&called))
+
+	// a separate provider instance doesn't share the cache
+	_, err = cachedRequest(&ProviderConfig{catalogCache: newCatalogCache()}, "service/server?datacenter=1")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), atomic.LoadInt32(&called))
+}
@@ -66,13 +66,10 @@ func getAvailableDatacenters(datacenters map[string]map[string]string) string {
 	return strings.Join(availableDatacenters, "\n")
 }
 
-func DataSourceDatacenterRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
-	provider := m.(*ProviderConfig)
-
-	result, err := request(provider, "GET", "service/server?datacenter=1", nil)
+func getDatacenters(provider *ProviderConfig) (map[string]map[string]string, error) {
+	result, err := cachedRequest(provider, "service/server?datacenter=1")
 	if err != nil {
-		d.SetId("")
-		return diag.FromErr(err)
+		return nil, err
 	}
 
 	datacenters := map[string]map[string]string{}
@@ -82,6 +79,17 @@ func DataSourceDatacenterRead(ctx context.Context, d *schema.ResourceData, m int
 			"country": datacenter.(map[string]interface{})["name"].(string),
 		}
 	}
+	return datacenters, nil
+}
+
+func DataSourceDatacenterRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	provider := m.(*ProviderConfig)
+
+	datacenters, err := getDatacenters(provider)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
 
 	id := d.Get("id").(string)
 	country := d.Get("country").(string)
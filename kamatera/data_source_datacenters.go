@@ -0,0 +1,88 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceDatacenters() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceDatacentersRead,
+
+		Schema: map[string]*schema.Schema{
+			"country_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include datacenters with a country matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include datacenters with a name matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"datacenters": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The matching datacenters, ordered by id.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"country": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceDatacentersRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	provider := m.(*ProviderConfig)
+
+	datacenters, err := getDatacenters(provider)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+
+	countryRegex := regexp.MustCompile(d.Get("country_regex").(string))
+	nameRegex := regexp.MustCompile(d.Get("name_regex").(string))
+	var ids []string
+	for datacenterId, datacenter := range datacenters {
+		if countryRegex.MatchString(datacenter["country"]) && nameRegex.MatchString(datacenter["name"]) {
+			ids = append(ids, datacenterId)
+		}
+	}
+	sort.Strings(ids)
+
+	matchingDatacenters := []map[string]interface{}{}
+	for _, datacenterId := range ids {
+		matchingDatacenters = append(matchingDatacenters, map[string]interface{}{
+			"id":      datacenterId,
+			"country": datacenters[datacenterId]["country"],
+			"name":    datacenters[datacenterId]["name"],
+		})
+	}
+
+	// the ID identifies the filters, as the list of matching datacenters may be empty
+	d.SetId(fmt.Sprintf("%s:%s", d.Get("country_regex").(string), d.Get("name_regex").(string)))
+	d.Set("datacenters", matchingDatacenters)
+	return nil
+}
@@ -0,0 +1,56 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSourceDatacentersRead(t *testing.T) {
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		if path == "service/server?datacenter=1" {
+			return []interface{}{
+				map[string]interface{}{"id": "US-NY2", "subCategory": "New York", "name": "United States"},
+				map[string]interface{}{"id": "EU", "subCategory": "Amsterdam", "name": "The Netherlands"},
+				map[string]interface{}{"id": "US-SC", "subCategory": "Santa Clara", "name": "United States"},
+			}, nil
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	d := schema.TestResourceDataRaw(t, dataSourceDatacenters().Schema, map[string]interface{}{})
+	diags := dataSourceDatacentersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, 3, d.Get("datacenters.#"))
+	assert.Equal(t, "EU", d.Get("datacenters.0.id"))
+	assert.Equal(t, "Amsterdam", d.Get("datacenters.0.name"))
+	assert.Equal(t, "The Netherlands", d.Get("datacenters.0.country"))
+
+	d = schema.TestResourceDataRaw(t, dataSourceDatacenters().Schema, map[string]interface{}{
+		"country_regex": "^United States$",
+		"name_regex":    "York",
+	})
+	diags = dataSourceDatacentersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, 1, d.Get("datacenters.#"))
+	assert.Equal(t, "US-NY2", d.Get("datacenters.0.id"))
+	assert.Equal(t, "^United States$:York", d.Id())
+
+	// no matching datacenters is an empty list, not a missing data source
+	d = schema.TestResourceDataRaw(t, dataSourceDatacenters().Schema, map[string]interface{}{
+		"country_regex": "Atlantis",
+	})
+	diags = dataSourceDatacentersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.NotEmpty(t, d.Id())
+	assert.Equal(t, 0, d.Get("datacenters.#"))
+	assert.NotNil(t, d.State())
+	assert.Equal(t, "0", d.State().Attributes["datacenters.#"])
+}
@@ -3,10 +3,14 @@ package kamatera
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
 func dataSourceImage() *schema.Resource {
@@ -21,9 +25,10 @@ func dataSourceImage() *schema.Resource {
 					"for public images or private_image_name for private images.",
 			},
 			"datacenter_id": {
-				Type:     schema.TypeString,
-				Required: true,
-				Description: "id field of datacenter data source",
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "id field of datacenter data source. If not set, the provider default_datacenter_id is used.",
 			},
 			"os": {
 				Type:     schema.TypeString,
@@ -37,6 +42,42 @@ func dataSourceImage() *schema.Resource {
 				Description: "Image code, to see available codes, set the datacenter_id and run terraform plan, " +
 					"it will show the list of available image OS/code combinations.",
 			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+				Description: "Regular expression to match against the image name, can be combined with os / code. " +
+					"If more than one image matches, most_recent must be set.",
+			},
+			"most_recent": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "If more than one image matches, use the image with the highest version in the code. " +
+					"For example, os = \"Ubuntu\" with name_regex = \"LTS\" selects the latest Ubuntu LTS image. " +
+					"If several codes have the same version, the shortest code is used, e.g. \"22.04 64bit\" " +
+					"rather than \"22.04 64bit_optimized\".",
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The image name.",
+			},
+			"size_gb": {
+				Type:        schema.TypeInt,
+				Computed:    true,
+				Description: "The private image disk size in GB.",
+			},
+			"created": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The private image creation date.",
+			},
+			"description": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The private image description.",
+			},
 			"private_image_name": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -82,26 +123,314 @@ func getAvailableImages(images map[string]map[string]string) string {
 	return strings.Join(availableImages, "\n")
 }
 
+func getImages(provider *ProviderConfig, datacenterId string) (map[string]map[string]string, error) {
+	result, err := cachedRequest(provider, fmt.Sprintf("service/server?images=1&datacenter=%s", datacenterId))
+	if err != nil {
+		return nil, err
+	}
+	images := map[string]map[string]string{}
+	for _, image := range result.([]interface{}) {
+		imageId := image.(map[string]interface{})["id"].(string)
+		images[imageId] = map[string]string{
+			"id":   imageId,
+			"os":   image.(map[string]interface{})["os"].(string),
+			"code": image.(map[string]interface{})["code"].(string),
+			"name": image.(map[string]interface{})["name"].(string),
+		}
+	}
+	return images, nil
+}
+
+var imageCodeVersionRegexp = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// imageCodeVersion returns the numeric parts of the first version number in an image code,
+// e.g. "24.04 64bit" returns [24 4].
+func imageCodeVersion(code string) []int {
+	var version []int
+	for _, part := range strings.Split(imageCodeVersionRegexp.FindString(code), ".") {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+	}
+	return version
+}
+
+// compareImageCodes compares the versions of two image codes, returns a positive number if code1 has the higher version.
+// Codes with the same version are ordered so that the shorter code comes first, e.g. "22.04 64bit" before
+// "22.04 64bit_optimized", so that the base image is preferred over its variants, then alphabetically.
+func compareImageCodes(code1 string, code2 string) int {
+	version1 := imageCodeVersion(code1)
+	version2 := imageCodeVersion(code2)
+	for i := 0; i < len(version1) && i < len(version2); i++ {
+		if version1[i] != version2[i] {
+			return version1[i] - version2[i]
+		}
+	}
+	if len(version1) != len(version2) {
+		return len(version1) - len(version2)
+	}
+	if len(code1) != len(code2) {
+		return len(code2) - len(code1)
+	}
+	return strings.Compare(code2, code1)
+}
+
+// compareImageRecency compares two images by code using compareImageCodes, images with the same code are ordered by
+// id, returns a positive number if image1 is the more recent image.
+func compareImageRecency(image1 map[string]string, image2 map[string]string) int {
+	if c := compareImageCodes(image1["code"], image2["code"]); c != 0 {
+		return c
+	}
+	return strings.Compare(image2["id"], image1["id"])
+}
+
+// compareImages orders images by os, then by code version from highest to lowest.
+func compareImages(image1 map[string]string, image2 map[string]string) bool {
+	if image1["os"] != image2["os"] {
+		return image1["os"] < image2["os"]
+	}
+	return compareImageRecency(image1, image2) > 0
+}
+
+// filterImages returns the images matching all the given filters, sorted using compareImages.
+// Empty filters match all images.
+func filterImages(images map[string]map[string]string, os string, code string, nameRegex string) ([]map[string]string, error) {
+	nameRe, err := regexp.Compile(nameRegex)
+	if err != nil {
+		return nil, err
+	}
+	var matches []map[string]string
+	for _, image := range images {
+		if (os == "" || image["os"] == os) && (code == "" || image["code"] == code) && nameRe.MatchString(image["name"]) {
+			matches = append(matches, image)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return compareImages(matches[i], matches[j])
+	})
+	return matches, nil
+}
+
+// getMostRecentImage returns the image with the highest code version, ties are resolved using compareImageRecency.
+func getMostRecentImage(images []map[string]string) map[string]string {
+	mostRecentImage := images[0]
+	for _, image := range images[1:] {
+		if compareImageRecency(image, mostRecentImage) > 0 {
+			mostRecentImage = image
+		}
+	}
+	return mostRecentImage
+}
+
+func imagesById(images []map[string]string) map[string]map[string]string {
+	res := map[string]map[string]string{}
+	for _, image := range images {
+		res[image["id"]] = image
+	}
+	return res
+}
+
+// getPrivateImages returns the private images from the account hard disk library. The response format is not
+// documented, each image is expected to have name and datacenter string fields and optional os, size, created and
+// description fields. An error is returned if the response doesn't match, so callers can use the image as is.
+func getPrivateImages(provider *ProviderConfig) ([]map[string]interface{}, error) {
+	result, err := cachedRequest(provider, "service/hdlib?private=1")
+	if err != nil {
+		return nil, err
+	}
+	list, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected response from Kamatera API: private images list is not a list")
+	}
+	var images []map[string]interface{}
+	for _, item := range list {
+		image, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unexpected response from Kamatera API: private image is not an object")
+		}
+		if _, ok := image["name"].(string); !ok {
+			return nil, fmt.Errorf("unexpected response from Kamatera API: private image has no name")
+		}
+		if _, ok := image["datacenter"].(string); !ok {
+			return nil, fmt.Errorf("unexpected response from Kamatera API: private image has no datacenter")
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// getImageOs returns the OS of a public or private image in the datacenter, returns an empty string if the image was not found.
+func getImageOs(provider *ProviderConfig, datacenterId string, imageId string) (string, error) {
+	images, err := getImages(provider, datacenterId)
+	if err != nil {
+		return "", err
+	}
+	if image, ok := images[imageId]; ok {
+		return image["os"], nil
+	}
+	privateImages, err := getPrivateImages(provider)
+	if err != nil {
+		return "", err
+	}
+	for _, image := range privateImages {
+		name, _ := image["name"].(string)
+		datacenter, _ := image["datacenter"].(string)
+		if name == imageId && datacenter == datacenterId {
+			os, _ := image["os"].(string)
+			return os, nil
+		}
+	}
+	return "", nil
+}
+
+// levenshteinDistance returns the number of single character edits required to change s1 into s2.
+func levenshteinDistance(s1 string, s2 string) int {
+	r1 := []rune(s1)
+	r2 := []rune(s2)
+	prev := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(r1); i++ {
+		cur := make([]int, len(r2)+1)
+		cur[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(r2)]
+}
+
+// getNearMatches returns up to 5 of the given names which are similar to name, closest first.
+func getNearMatches(name string, names []string) []string {
+	type nearMatch struct {
+		name     string
+		distance int
+	}
+	var nearMatches []nearMatch
+	seen := map[string]bool{}
+	for _, n := range names {
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		distance := levenshteinDistance(strings.ToLower(name), strings.ToLower(n))
+		if distance <= max(3, len(name)/3) || strings.Contains(strings.ToLower(n), strings.ToLower(name)) {
+			nearMatches = append(nearMatches, nearMatch{n, distance})
+		}
+	}
+	sort.Slice(nearMatches, func(i, j int) bool {
+		if nearMatches[i].distance != nearMatches[j].distance {
+			return nearMatches[i].distance < nearMatches[j].distance
+		}
+		return nearMatches[i].name < nearMatches[j].name
+	})
+	var res []string
+	for i := 0; i < len(nearMatches) && i < 5; i++ {
+		res = append(res, nearMatches[i].name)
+	}
+	return res
+}
+
+func dataSourcePrivateImageRead(d *schema.ResourceData, provider *ProviderConfig, datacenterId string, privateImageName string) diag.Diagnostics {
+	privateImages, err := getPrivateImages(provider)
+	if err != nil {
+		// the private image is used as is, the server creation fails if it doesn't exist in the datacenter
+		d.SetId(privateImageName)
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("failed to validate private image %s", privateImageName),
+			Detail:   fmt.Sprintf("the hard disk library could not be listed or was not in the expected format, the private image is used without validation: %s", err),
+		}}
+	}
+	var names []string
+	var otherDatacenters []string
+	for _, image := range privateImages {
+		name, _ := image["name"].(string)
+		if name == "" {
+			continue
+		}
+		names = append(names, name)
+		if name != privateImageName {
+			continue
+		}
+		if datacenter, _ := image["datacenter"].(string); datacenter != datacenterId {
+			otherDatacenters = append(otherDatacenters, datacenter)
+			continue
+		}
+		os, _ := image["os"].(string)
+		size, _ := image["size"].(float64)
+		created, _ := image["created"].(string)
+		description, _ := image["description"].(string)
+		d.SetId(privateImageName)
+		d.Set("os", os)
+		d.Set("size_gb", int(size))
+		d.Set("created", created)
+		d.Set("description", description)
+		return nil
+	}
+	d.SetId("")
+	if len(otherDatacenters) > 0 {
+		sort.Strings(otherDatacenters)
+		return diag.Errorf("private image %s is not available in datacenter %s, it is available in the following datacenters: %s",
+			privateImageName, datacenterId, strings.Join(otherDatacenters, ", "))
+	}
+	nearMatches := getNearMatches(privateImageName, names)
+	if len(nearMatches) > 0 {
+		return diag.Errorf("could not find private image %s, did you mean one of: %s", privateImageName, strings.Join(nearMatches, ", "))
+	}
+	return diag.Errorf("could not find private image %s, see Kamatera Console -> Hard Disk Library -> My Private Images for available private images", privateImageName)
+}
+
 func dataSourceImageRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	id := d.Get("id").(string)
-	datacenterId := d.Get("datacenter_id").(string)
+	datacenterId, err := getDatacenterIdOrDefault(d, m)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	d.Set("datacenter_id", datacenterId)
 	os := d.Get("os").(string)
 	code := d.Get("code").(string)
+	nameRegex := d.Get("name_regex").(string)
+	mostRecent := d.Get("most_recent").(bool)
 	privateImageName := d.Get("private_image_name").(string)
 	if privateImageName == "" {
 		provider := m.(*ProviderConfig)
-		result, err := request(provider, "GET", fmt.Sprintf("service/server?images=1&datacenter=%s", datacenterId), nil)
+		images, err := getImages(provider, datacenterId)
 		if err != nil {
 			d.SetId("")
 			return diag.FromErr(err)
 		}
-		images := map[string]map[string]string{}
-		for _, image := range result.([]interface{}) {
-			images[image.(map[string]interface{})["id"].(string)] = map[string]string{
-				"os":   image.(map[string]interface{})["os"].(string),
-				"code": image.(map[string]interface{})["code"].(string),
-				"name": image.(map[string]interface{})["name"].(string),
+		if nameRegex != "" || mostRecent {
+			matches, err := filterImages(images, os, code, nameRegex)
+			if err != nil {
+				d.SetId("")
+				return diag.FromErr(err)
+			}
+			if len(matches) == 0 {
+				d.SetId("")
+				return diag.Errorf("could not find matching image, available public images: \n%s", getAvailableImages(images))
+			} else if len(matches) > 1 && !mostRecent {
+				d.SetId("")
+				return diag.Errorf("found %d matching images, set most_recent to true to select the most recent image, matching images: \n%s", len(matches), getAvailableImages(imagesById(matches)))
 			}
+			image := getMostRecentImage(matches)
+			d.SetId(image["id"])
+			d.Set("code", image["code"])
+			d.Set("os", image["os"])
+			d.Set("name", image["name"])
+			return nil
 		}
 		image, hasImage := images[id]
 		osImageIds := getImageMatchesBy(images, "os", os)
@@ -112,6 +441,7 @@ func dataSourceImageRead(ctx context.Context, d *schema.ResourceData, m interfac
 			d.SetId(image["id"])
 			d.Set("code", image["code"])
 			d.Set("os", image["os"])
+			d.Set("name", image["name"])
 			return nil
 		} else if len(osImageIds) == 1 &&
 			(!hasImage || image["os"] == os) &&
@@ -119,12 +449,14 @@ func dataSourceImageRead(ctx context.Context, d *schema.ResourceData, m interfac
 			d.SetId(osImageIds[0])
 			d.Set("code", images[osImageIds[0]]["code"])
 			d.Set("os", os)
+			d.Set("name", images[osImageIds[0]]["name"])
 			return nil
 		} else if len(codeImageIds) == 1 &&
 			(!hasImage || image["code"] == code) {
 			d.SetId(codeImageIds[0])
 			d.Set("code", code)
 			d.Set("os", images[codeImageIds[0]]["os"])
+			d.Set("name", images[codeImageIds[0]]["name"])
 			return nil
 		} else {
 			d.SetId("")
@@ -135,11 +467,10 @@ func dataSourceImageRead(ctx context.Context, d *schema.ResourceData, m interfac
 				"Private images are not listed, see the following link for details: https://github.com/Kamatera/terraform-provider-kamatera/blob/master/README.md#using-a-private-image", getAvailableImages(images))
 		}
 	} else {
-		if code != "" || os != "" {
+		if code != "" || os != "" || nameRegex != "" || mostRecent {
 			return diag.Errorf("When specifying private_image_name, other attributes must not be set")
 		} else {
-			d.SetId(privateImageName)
-			return nil
+			return dataSourcePrivateImageRead(d, m.(*ProviderConfig), datacenterId, privateImageName)
 		}
 	}
 }
@@ -0,0 +1,141 @@
+package kamatera
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+var testImages = map[string]map[string]string{
+	"EU:1": {"id": "EU:1", "os": "Ubuntu", "code": "20.04 64bit", "name": "Ubuntu Server version 20.04 LTS"},
+	"EU:2": {"id": "EU:2", "os": "Ubuntu", "code": "24.04 64bit", "name": "Ubuntu Server version 24.04 LTS"},
+	"EU:3": {"id": "EU:3", "os": "Ubuntu", "code": "24.10 64bit", "name": "Ubuntu Server version 24.10"},
+	"EU:4": {"id": "EU:4", "os": "Ubuntu", "code": "22.04 64bit", "name": "Ubuntu Server version 22.04 LTS"},
+	"EU:5": {"id": "EU:5", "os": "Debian", "code": "12 64bit", "name": "Debian version 12"},
+	"EU:6": {"id": "EU:6", "os": "Debian", "code": "9.13 64bit", "name": "Debian version 9.13"},
+}
+
+func TestImageCodeVersion(t *testing.T) {
+	for code, expected := range map[string][]int{
+		"24.04 64bit":           {24, 4},
+		"22.04 64bit_optimized": {22, 4},
+		"2022 Standard":         {2022},
+		"9.13 64bit":            {9, 13},
+		"latest":                nil,
+	} {
+		assert.Equal(t, expected, imageCodeVersion(code), "Unexpected version for code: %s", code)
+	}
+}
+
+func TestFilterImages(t *testing.T) {
+	matches, err := filterImages(testImages, "", "", "")
+	assert.NoError(t, err)
+	var ids []string
+	for _, image := range matches {
+		ids = append(ids, image["id"])
+	}
+	assert.Equal(t, []string{"EU:5", "EU:6", "EU:3", "EU:2", "EU:4", "EU:1"}, ids)
+
+	matches, err = filterImages(testImages, "Ubuntu", "", "LTS$")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 3)
+	assert.Equal(t, "EU:2", getMostRecentImage(matches)["id"])
+
+	matches, err = filterImages(testImages, "", "12 64bit", "")
+	assert.NoError(t, err)
+	assert.Len(t, matches, 1)
+	assert.Equal(t, "EU:5", getMostRecentImage(matches)["id"])
+
+	_, err = filterImages(testImages, "", "", "(")
+	assert.Error(t, err)
+	// the base code is preferred over variants with the same version, regardless of the input order
+	variants := []map[string]string{
+		{"id": "EU:7", "os": "Ubuntu", "code": "22.04 64bit_optimized"},
+		{"id": "EU:8", "os": "Ubuntu", "code": "22.04 64bit"},
+		{"id": "EU:9", "os": "Ubuntu", "code": "22.04 64bit_minimal"},
+	}
+	assert.Equal(t, "EU:8", getMostRecentImage(variants)["id"])
+	assert.Equal(t, "EU:8", getMostRecentImage([]map[string]string{variants[1], variants[0], variants[2]})["id"])
+	assert.Greater(t, compareImageCodes("22.04 64bit_minimal", "22.04 64bit_optimized"), 0)
+	assert.Greater(t, compareImageCodes("24.04 64bit_optimized", "22.04 64bit"), 0)
+	// images with the same code are ordered by id
+	assert.Equal(t, "EU:10", getMostRecentImage([]map[string]string{
+		{"id": "EU:11", "code": "22.04 64bit"}, {"id": "EU:10", "code": "22.04 64bit"},
+	})["id"])
+}
+
+func TestGetNearMatches(t *testing.T) {
+	assert.Equal(t, 0, levenshteinDistance("ubuntu", "ubuntu"))
+	assert.Equal(t, 3, levenshteinDistance("kitten", "sitting"))
+	names := []string{"my-web-image", "my-web-image-v2", "my-db-image", "other", "my-web-image"}
+	assert.Equal(t, []string{"my-db-image", "my-web-image"}, getNearMatches("my-wb-image", names))
+	assert.Equal(t, []string{"my-web-image", "my-web-image-v2"}, getNearMatches("web-image", names))
+	assert.Len(t, getNearMatches("something-else-entirely", names), 0)
+}
+
+func TestDataSourcePrivateImageRead(t *testing.T) {
+	var privateImages interface{}
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		if path != "service/hdlib?private=1" {
+			return nil, fmt.Errorf("unexpected request: %s", path)
+		}
+		if privateImages == nil {
+			return nil, fmt.Errorf("hdlib failed")
+		}
+		return privateImages, nil
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	privateImages = []interface{}{
+		map[string]interface{}{"name": "my-web-image", "datacenter": "EU", "os": "Ubuntu", "size": 20.0,
+			"created": "2024-01-01", "description": "web server"},
+		map[string]interface{}{"name": "my-db-image", "datacenter": "IL", "os": nil, "size": nil, "created": nil,
+			"description": nil},
+	}
+	d := schema.TestResourceDataRaw(t, dataSourceImage().Schema, map[string]interface{}{})
+	assert.Len(t, dataSourcePrivateImageRead(d, &ProviderConfig{}, "EU", "my-web-image"), 0)
+	assert.Equal(t, "my-web-image", d.Id())
+	assert.Equal(t, 20, d.Get("size_gb"))
+	assert.Equal(t, "web server", d.Get("description"))
+
+	// null fields are read as empty values
+	d = schema.TestResourceDataRaw(t, dataSourceImage().Schema, map[string]interface{}{})
+	assert.Len(t, dataSourcePrivateImageRead(d, &ProviderConfig{}, "IL", "my-db-image"), 0)
+	assert.Equal(t, "my-db-image", d.Id())
+	assert.Equal(t, 0, d.Get("size_gb"))
+	assert.Equal(t, "", d.Get("description"))
+
+	diags := dataSourcePrivateImageRead(d, &ProviderConfig{}, "EU", "my-db-image")
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "private image my-db-image is not available in datacenter EU, it is available in the following datacenters: IL", diags[0].Summary)
+	}
+	diags = dataSourcePrivateImageRead(d, &ProviderConfig{}, "EU", "my-wb-image")
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "could not find private image my-wb-image, did you mean one of: my-db-image, my-web-image", diags[0].Summary)
+	}
+
+	// the private image is used without validation if the hard disk library can't be listed
+	// or the response is not in the expected format
+	for _, images := range []interface{}{
+		nil,
+		map[string]interface{}{"images": []interface{}{}},
+		[]interface{}{"invalid"},
+		[]interface{}{map[string]interface{}{"title": "my-web-image", "datacenter": "EU"}},
+		[]interface{}{map[string]interface{}{"name": "my-web-image", "dc": "EU"}},
+	} {
+		privateImages = images
+		d = schema.TestResourceDataRaw(t, dataSourceImage().Schema, map[string]interface{}{})
+		diags = dataSourcePrivateImageRead(d, &ProviderConfig{}, "EU", "my-web-image")
+		if assert.Len(t, diags, 1) {
+			assert.Equal(t, diag.Warning, diags[0].Severity)
+			assert.Equal(t, "failed to validate private image my-web-image", diags[0].Summary)
+		}
+		assert.Equal(t, "my-web-image", d.Id())
+	}
+}
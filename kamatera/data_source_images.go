@@ -0,0 +1,110 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceImages() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceImagesRead,
+
+		Schema: map[string]*schema.Schema{
+			"datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "id field of datacenter data source. If not set, the provider default_datacenter_id is used.",
+			},
+			"os_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include images with an OS matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"code_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include images with a code matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include images with a name matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"images": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Description: "The matching public images, ordered by OS and then by the version in the code " +
+					"from highest to lowest.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"os": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"code": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceImagesRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	provider := m.(*ProviderConfig)
+	datacenterId, err := getDatacenterIdOrDefault(d, m)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	d.Set("datacenter_id", datacenterId)
+
+	images, err := getImages(provider, datacenterId)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+
+	matches, err := filterImages(images, "", "", d.Get("name_regex").(string))
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	osRegex := regexp.MustCompile(d.Get("os_regex").(string))
+	codeRegex := regexp.MustCompile(d.Get("code_regex").(string))
+	var matchingImages []map[string]interface{}
+	for _, image := range matches {
+		if osRegex.MatchString(image["os"]) && codeRegex.MatchString(image["code"]) {
+			matchingImages = append(matchingImages, map[string]interface{}{
+				"id":   image["id"],
+				"os":   image["os"],
+				"code": image["code"],
+				"name": image["name"],
+			})
+		}
+	}
+
+	d.SetId(fmt.Sprintf("%s:%s:%s:%s", datacenterId, d.Get("os_regex").(string),
+		d.Get("code_regex").(string), d.Get("name_regex").(string)))
+	d.Set("images", matchingImages)
+	return nil
+}
@@ -0,0 +1,48 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSourceImagesRead(t *testing.T) {
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		if path != "service/server?images=1&datacenter=EU" {
+			return nil, fmt.Errorf("unexpected request: %s", path)
+		}
+		var images []interface{}
+		for _, image := range testImages {
+			images = append(images, map[string]interface{}{
+				"id": image["id"], "os": image["os"], "code": image["code"], "name": image["name"],
+			})
+		}
+		return images, nil
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	d := schema.TestResourceDataRaw(t, dataSourceImages().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"os_regex":      "^Ubuntu$",
+		"name_regex":    "LTS$",
+	})
+	assert.Len(t, dataSourceImagesRead(context.Background(), d, &ProviderConfig{}), 0)
+	assert.Equal(t, "EU:^Ubuntu$::LTS$", d.Id())
+	assert.Equal(t, 3, d.Get("images.#"))
+	assert.Equal(t, "EU:2", d.Get("images.0.id"))
+
+	// different filters in the same datacenter get a different id
+	d = schema.TestResourceDataRaw(t, dataSourceImages().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"os_regex":      "^Debian$",
+	})
+	assert.Len(t, dataSourceImagesRead(context.Background(), d, &ProviderConfig{}), 0)
+	assert.Equal(t, "EU:^Debian$::", d.Id())
+	assert.Equal(t, 2, d.Get("images.#"))
+}
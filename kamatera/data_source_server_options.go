@@ -0,0 +1,129 @@
+package kamatera
+
+import (
+	"context"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceServerOptions() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceServerOptionsRead,
+		Description: "Valid server configuration options, as used to validate the kamatera_server resource.",
+
+		Schema: map[string]*schema.Schema{
+			"datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "If set, only include monthly traffic packages for this datacenter.",
+			},
+			"datacenter_ids": {
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+				Description: "IDs of the datacenters which support server creation.",
+			},
+			"cpu_types": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The CPU types, ordered by type.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {
+							Type:        schema.TypeString,
+							Computed:    true,
+							Description: "The CPU type, for use in the cpu_type attribute of the server.",
+						},
+						"cores": {
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeInt},
+							Computed:    true,
+							Description: "Valid number of CPU cores for this CPU type, from lowest to highest.",
+						},
+						"ram_mb": {
+							Type:        schema.TypeList,
+							Elem:        &schema.Schema{Type: schema.TypeInt},
+							Computed:    true,
+							Description: "Valid RAM sizes in MB for this CPU type, from lowest to highest.",
+						},
+					},
+				},
+			},
+			"disk_sizes_gb": {
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeInt},
+				Computed:    true,
+				Description: "Valid disk sizes in GB, from lowest to highest.",
+			},
+			"monthly_traffic_packages": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "Valid monthly traffic packages for each datacenter, ordered by datacenter ID.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"datacenter_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"packages": {
+							Type:     schema.TypeList,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceServerOptionsRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	err := loadServerOptions()
+	if err != nil {
+		d.SetId("")
+		return diag.Errorf("failed to load server options: %s", err)
+	}
+
+	var cpuTypes []map[string]interface{}
+	for _, cpuType := range serverOptionsCpuTypes() {
+		cpuTypes = append(cpuTypes, map[string]interface{}{
+			"type":   cpuType.cpuType,
+			"cores":  cpuType.cores,
+			"ram_mb": serverOptionsRamMB(cpuType.cpuType),
+		})
+	}
+
+	datacenterId := d.Get("datacenter_id").(string)
+	datacenterIds := serverOptionsDatacenterIds()
+	var monthlyTrafficPackages []map[string]interface{}
+	for _, id := range datacenterIds {
+		if datacenterId != "" && id != datacenterId {
+			continue
+		}
+		packages := serverOptionsMonthlyTrafficPackages(id)
+		if len(packages) > 0 {
+			monthlyTrafficPackages = append(monthlyTrafficPackages, map[string]interface{}{
+				"datacenter_id": id,
+				"packages":      packages,
+			})
+		}
+	}
+	if datacenterId != "" && len(monthlyTrafficPackages) == 0 {
+		if err := serverOptionsValidateDatacenter(datacenterId); err != nil {
+			d.SetId("")
+			return diag.FromErr(err)
+		}
+	}
+
+	if datacenterId == "" {
+		d.SetId("server_options")
+	} else {
+		d.SetId(datacenterId)
+	}
+	d.Set("datacenter_ids", datacenterIds)
+	d.Set("cpu_types", cpuTypes)
+	d.Set("disk_sizes_gb", serverOptionsDiskSizesGB())
+	d.Set("monthly_traffic_packages", monthlyTrafficPackages)
+	return nil
+}
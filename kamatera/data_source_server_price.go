@@ -0,0 +1,201 @@
+package kamatera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceServerPrice() *schema.Resource {
+	priceSchema := func(description string) *schema.Schema {
+		return &schema.Schema{
+			Type:        schema.TypeString,
+			Computed:    true,
+			Description: description,
+		}
+	}
+	return &schema.Resource{
+		ReadContext: dataSourceServerPriceRead,
+		Description: "Estimated price of a server configuration, calculated from the same pricing data used to " +
+			"estimate the kamatera_server prices. If the pricing data can't be downloaded, the snapshot set in the " +
+			"KAMATERA_SERVER_OPTIONS_SNAPSHOT environment variable is used.",
+
+		Schema: map[string]*schema.Schema{
+			"datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "id attribute of datacenter data source. If not set, the provider default_datacenter_id is used.",
+			},
+			"cpu_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Default:     "B",
+				Description: "The CPU type - a single upper-case letter.",
+			},
+			"cpu_cores": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     2,
+				Description: "Number of CPU cores.",
+			},
+			"ram_mb": {
+				Type:        schema.TypeInt,
+				Optional:    true,
+				Default:     1024,
+				Description: "Amount of RAM in MB.",
+			},
+			"disk_sizes_gb": {
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeInt, ValidateDiagFunc: validateServerOptionsDiskSizeGB},
+				MinItems:    1,
+				MaxItems:    4,
+				Required:    true,
+				Description: "List of disk sizes in GB.",
+			},
+			"billing_cycle": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "hourly",
+				Description:  "hourly or monthly.",
+				ValidateFunc: validation.StringInSlice([]string{"hourly", "monthly"}, false),
+			},
+			"monthly_traffic_package": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				Description: "Monthly traffic package, used only for monthly billing cycle. If not set, the first " +
+					"traffic package available in the datacenter is used.",
+			},
+			"daily_backup": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Set to true to include daily backups.",
+			},
+			"managed": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     false,
+				Description: "Set to true to include managed support services.",
+			},
+			"price_monthly_on": priceSchema("The monthly price if server is turned on for the entire month."),
+			"price_hourly_on":  priceSchema("The hourly price if server is turned on for the entire hour."),
+			"price_hourly_off": priceSchema("The hourly price if server is turned off for the entire hour."),
+			"breakdown": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Description: "The price of each component which makes up the total price. Components are cpu, ram, " +
+					"disk_0 to disk_3, traffic, daily_backup and managed.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"component": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"price_monthly_on": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"price_hourly_on": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"price_hourly_off": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceServerPriceRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	err := loadServerOptions()
+	if err != nil {
+		d.SetId("")
+		return diag.Errorf("failed to load server options: %s", err)
+	}
+
+	datacenterId, err := getDatacenterIdOrDefault(d, m)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	d.Set("datacenter_id", datacenterId)
+
+	config := serverOptionsConfig{
+		datacenterId:          datacenterId,
+		cpuType:               d.Get("cpu_type").(string),
+		cpuCores:              d.Get("cpu_cores").(int),
+		ramMB:                 d.Get("ram_mb").(int),
+		billingCycle:          d.Get("billing_cycle").(string),
+		monthlyTrafficPackage: d.Get("monthly_traffic_package").(string),
+		dailyBackup:           d.Get("daily_backup").(bool),
+		managed:               d.Get("managed").(bool),
+	}
+	for _, diskSize := range d.Get("disk_sizes_gb").([]interface{}) {
+		config.diskSizesGB = append(config.diskSizesGB, diskSize.(int))
+	}
+	if config.billingCycle == "monthly" && config.monthlyTrafficPackage == "" {
+		if packages := serverOptionsMonthlyTrafficPackages(config.datacenterId); len(packages) > 0 {
+			config.monthlyTrafficPackage = packages[0]
+		}
+	}
+
+	optionErrors := serverOptionsValidateConfig(config)
+	if len(optionErrors) > 0 {
+		var diags diag.Diagnostics
+		for _, e := range optionErrors {
+			if optionsError, ok := e.(*serverOptionsError); ok {
+				diags = append(diags, optionsError.Diagnostic())
+			} else {
+				diags = append(diags, diag.FromErr(e)...)
+			}
+		}
+		d.SetId("")
+		return diags
+	}
+
+	price, components, err := serverOptionsEstimatePrice(config)
+	if errors.Is(err, errServerPriceUnavailable) {
+		// the configuration is valid, only the prices are unknown
+		d.SetId(config.datacenterId)
+		d.Set("monthly_traffic_package", config.monthlyTrafficPackage)
+		d.Set("price_monthly_on", "")
+		d.Set("price_hourly_on", "")
+		d.Set("price_hourly_off", "")
+		d.Set("breakdown", nil)
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "the server price can't be estimated",
+			Detail:   fmt.Sprintf("the pricing data doesn't include the server prices, the price attributes are empty: %s", err),
+		}}
+	} else if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	var breakdown []map[string]interface{}
+	for _, component := range components {
+		breakdown = append(breakdown, map[string]interface{}{
+			"component":        component.name,
+			"price_monthly_on": formatPrice(component.price.monthlyOn),
+			"price_hourly_on":  formatPrice(component.price.hourlyOn),
+			"price_hourly_off": formatPrice(component.price.hourlyOff),
+		})
+	}
+
+	d.SetId(config.datacenterId)
+	d.Set("monthly_traffic_package", config.monthlyTrafficPackage)
+	d.Set("price_monthly_on", formatPrice(price.monthlyOn))
+	d.Set("price_hourly_on", formatPrice(price.hourlyOn))
+	d.Set("price_hourly_off", formatPrice(price.hourlyOff))
+	d.Set("breakdown", breakdown)
+	return nil
+}
@@ -0,0 +1,168 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceServers() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceServersRead,
+
+		Schema: map[string]*schema.Schema{
+			"datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Only include servers in this datacenter, id attribute of datacenter data source.",
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "Only include servers with a name matching this regular expression.",
+				ValidateFunc: validation.StringIsValidRegExp,
+			},
+			"tags": {
+				Type:        schema.TypeSet,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Optional:    true,
+				Description: "Only include servers which have all of these tags.",
+			},
+			"servers": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The matching servers, ordered by name.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"internal_server_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"datacenter_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"power_on": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"tags": {
+							Type:     schema.TypeList,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Computed: true,
+						},
+						"notes": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"public_ips": {
+							Type:     schema.TypeList,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Computed: true,
+						},
+						"private_ips": {
+							Type:     schema.TypeList,
+							Elem:     &schema.Schema{Type: schema.TypeString},
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// getServerInfoTags returns the server tags from the server info, sorted. Missing or null tags are read as no tags.
+func getServerInfoTags(server map[string]interface{}) []string {
+	var serverTags []string
+	tags, _ := server["tags"].([]interface{})
+	for _, tag := range tags {
+		if tag, ok := tag.(string); ok {
+			serverTags = append(serverTags, tag)
+		}
+	}
+	sort.Strings(serverTags)
+	return serverTags
+}
+
+// serverHasTags returns true if the server has all the given tags.
+func serverHasTags(server map[string]interface{}, tags []interface{}) bool {
+	serverTags := map[string]bool{}
+	for _, tag := range getServerInfoTags(server) {
+		serverTags[tag] = true
+	}
+	for _, tag := range tags {
+		if !serverTags[tag.(string)] {
+			return false
+		}
+	}
+	return true
+}
+
+func dataSourceServersRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	provider := m.(*ProviderConfig)
+
+	servers, err := listServers(provider)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+
+	datacenterId := d.Get("datacenter_id").(string)
+	nameRegex := regexp.MustCompile(d.Get("name_regex").(string))
+	tags := d.Get("tags").(*schema.Set).List()
+	var matchingServers []map[string]interface{}
+	for _, server := range servers {
+		server := server.(map[string]interface{})
+		if datacenterId != "" && server["datacenter"].(string) != datacenterId {
+			continue
+		}
+		if !nameRegex.MatchString(server["name"].(string)) {
+			continue
+		}
+		serverInfo, err := getServerInfo(provider, server["id"].(string))
+		if err != nil {
+			d.SetId("")
+			return diag.FromErr(err)
+		}
+		if !serverHasTags(serverInfo, tags) {
+			continue
+		}
+		publicIPs, privateIPs := getServerIPs(serverInfo)
+		serverTags := getServerInfoTags(serverInfo)
+		notes, _ := serverInfo["notes"].(string)
+		matchingServers = append(matchingServers, map[string]interface{}{
+			"internal_server_id": serverInfo["id"].(string),
+			"name":               serverInfo["name"].(string),
+			"datacenter_id":      serverInfo["datacenter"].(string),
+			"power_on":           serverInfo["power"].(string) == "on",
+			"tags":               serverTags,
+			"notes":              notes,
+			"public_ips":         publicIPs,
+			"private_ips":        privateIPs,
+		})
+	}
+	sort.Slice(matchingServers, func(i, j int) bool {
+		return matchingServers[i]["name"].(string) < matchingServers[j]["name"].(string)
+	})
+
+	// the ID identifies the filters, as the list of matching servers may be empty
+	var tagStrings []string
+	for _, tag := range tags {
+		tagStrings = append(tagStrings, tag.(string))
+	}
+	sort.Strings(tagStrings)
+	d.SetId(fmt.Sprintf("%s:%s:%s", datacenterId, d.Get("name_regex").(string), strings.Join(tagStrings, ",")))
+	d.Set("servers", matchingServers)
+	return nil
+}
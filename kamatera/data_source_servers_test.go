@@ -0,0 +1,77 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataSourceServersRead(t *testing.T) {
+	servers := map[string]map[string]interface{}{
+		"1": {"id": "1", "name": "web-2", "datacenter": "EU", "power": "on", "tags": []interface{}{"web", "prod"}, "notes": "",
+			"networks": []interface{}{map[string]interface{}{"network": "wan-eu", "ips": []interface{}{"1.2.3.4"}}}},
+		"2": {"id": "2", "name": "web-1", "datacenter": "EU", "power": "off", "tags": []interface{}{"web"}, "notes": "staging",
+			"networks": []interface{}{map[string]interface{}{"network": "lan-1-private", "ips": []interface{}{"172.16.0.2"}}}},
+		"3": {"id": "3", "name": "db-1", "datacenter": "IL", "power": "on", "tags": []interface{}{"db", "prod"}, "notes": "",
+			"networks": []interface{}{}},
+		"4": {"id": "4", "name": "web-3", "datacenter": "EU", "power": "on", "tags": nil, "notes": nil,
+			"networks": []interface{}{}},
+	}
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		switch path {
+		case "service/servers":
+			return []interface{}{
+				map[string]interface{}{"id": "1", "name": "web-2", "datacenter": "EU"},
+				map[string]interface{}{"id": "2", "name": "web-1", "datacenter": "EU"},
+				map[string]interface{}{"id": "3", "name": "db-1", "datacenter": "IL"},
+				map[string]interface{}{"id": "4", "name": "web-3", "datacenter": "EU"},
+			}, nil
+		case "service/server/info":
+			return []interface{}{servers[body.(listServersPostValues).ID]}, nil
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	d := schema.TestResourceDataRaw(t, dataSourceServers().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+	})
+	diags := dataSourceServersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, 3, d.Get("servers.#"))
+	assert.Equal(t, "web-1", d.Get("servers.0.name"))
+	assert.Equal(t, false, d.Get("servers.0.power_on"))
+	assert.Equal(t, "staging", d.Get("servers.0.notes"))
+	assert.Equal(t, []interface{}{"172.16.0.2"}, d.Get("servers.0.private_ips"))
+	assert.Equal(t, []interface{}{"prod", "web"}, d.Get("servers.1.tags"))
+	assert.Equal(t, []interface{}{"1.2.3.4"}, d.Get("servers.1.public_ips"))
+	// null tags and notes are read as empty values
+	assert.Equal(t, "web-3", d.Get("servers.2.name"))
+	assert.Equal(t, 0, d.Get("servers.2.tags.#"))
+	assert.Equal(t, "", d.Get("servers.2.notes"))
+
+	d = schema.TestResourceDataRaw(t, dataSourceServers().Schema, map[string]interface{}{
+		"tags": []interface{}{"prod"},
+	})
+	diags = dataSourceServersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, 2, d.Get("servers.#"))
+	assert.Equal(t, "db-1", d.Get("servers.0.name"))
+	assert.Equal(t, "web-2", d.Get("servers.1.name"))
+	assert.Equal(t, "::prod", d.Id())
+
+	d = schema.TestResourceDataRaw(t, dataSourceServers().Schema, map[string]interface{}{
+		"name_regex": "^web-",
+		"tags":       []interface{}{"prod", "web"},
+	})
+	diags = dataSourceServersRead(context.Background(), d, &ProviderConfig{})
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, 1, d.Get("servers.#"))
+	assert.Equal(t, "1", d.Get("servers.0.internal_server_id"))
+}
@@ -0,0 +1,179 @@
+package kamatera
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceSubnetIps() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceSubnetIpsRead,
+
+		Schema: map[string]*schema.Schema{
+			"datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "id attribute of datacenter data source. If not set, the provider default_datacenter_id is used.",
+			},
+			"subnet_id": {
+				Type:        schema.TypeInt,
+				Required:    true,
+				Description: "id attribute of a kamatera_network subnet.",
+			},
+			"network": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The full name of the network the subnet belongs to.",
+			},
+			"gateway": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The subnet gateway IP, empty if the subnet has no gateway.",
+			},
+			"used": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "IPs from the subnet which are attached to servers.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"ip": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"server_name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+					},
+				},
+			},
+			"free": {
+				Type:        schema.TypeList,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Computed:    true,
+				Description: "IPs from the subnet which are not used by servers and are not the gateway, ordered by IP.",
+			},
+		},
+	}
+}
+
+// subnetHostIPs returns all the assignable IPs of an IPv4 subnet, excluding the network and broadcast addresses.
+func subnetHostIPs(subnetIP string, subnetBit int) ([]string, error) {
+	ip := net.ParseIP(subnetIP).To4()
+	if ip == nil {
+		return nil, fmt.Errorf("invalid subnet IP: %s", subnetIP)
+	}
+	if subnetBit < 16 || subnetBit > 30 {
+		return nil, fmt.Errorf("unsupported subnet bit: %d", subnetBit)
+	}
+	mask := net.CIDRMask(subnetBit, 32)
+	first := binary.BigEndian.Uint32(ip.Mask(mask))
+	last := first | ^binary.BigEndian.Uint32(mask)
+	var ips []string
+	for i := first + 1; i < last; i++ {
+		hostIP := make(net.IP, 4)
+		binary.BigEndian.PutUint32(hostIP, i)
+		ips = append(ips, hostIP.String())
+	}
+	return ips, nil
+}
+
+func findDatacenterSubnet(provider *ProviderConfig, datacenter string, subnetId int) (fullName string, subnet map[string]interface{}, err error) {
+	result, err := mockableRequest(provider, "GET", fmt.Sprintf("service/networks?datacenter=%s", datacenter), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	for _, network := range result.([]interface{}) {
+		network := network.(map[string]interface{})
+		networkNames := network["names"].([]interface{})
+		if len(networkNames) != 1 {
+			continue
+		}
+		subnetsResult, err := mockableRequest(provider, "GET", fmt.Sprintf("service/network/subnets?datacenter=%s&vlanId=%v", datacenter, network["vlanId"].(float64)), nil)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, subnet := range subnetsResult.([]interface{}) {
+			subnet := subnet.(map[string]interface{})
+			if int(subnet["subnetId"].(float64)) == subnetId {
+				return networkNames[0].(string), subnet, nil
+			}
+		}
+	}
+	return "", nil, fmt.Errorf("did not find subnet %d in datacenter %s", subnetId, datacenter)
+}
+
+func dataSourceSubnetIpsRead(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
+	provider := m.(*ProviderConfig)
+	datacenter, err := getDatacenterIdOrDefault(d, m)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	d.Set("datacenter_id", datacenter)
+	subnetId := d.Get("subnet_id").(int)
+
+	fullName, subnet, err := findDatacenterSubnet(provider, datacenter, subnetId)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	hostIPs, err := subnetHostIPs(subnet["subnetIp"].(string), int(subnet["subnetBit"].(float64)))
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+	serversInfo, err := getDatacenterServersInfo(provider, datacenter)
+	if err != nil {
+		d.SetId("")
+		return diag.FromErr(err)
+	}
+
+	gateway, _ := subnet["gateway"].(string)
+	subnetIPs := make(map[string]bool)
+	for _, ip := range hostIPs {
+		subnetIPs[ip] = true
+	}
+	usedIPs := make(map[string]bool)
+	var used []map[string]interface{}
+	for _, server := range serversInfo {
+		serverName, _ := server["name"].(string)
+		networks, _ := server["networks"].([]interface{})
+		for _, network := range networks {
+			network, _ := network.(map[string]interface{})
+			if name, _ := network["network"].(string); name != fullName {
+				continue
+			}
+			ips, _ := network["ips"].([]interface{})
+			for _, ip := range ips {
+				ip, _ := ip.(string)
+				if subnetIPs[ip] {
+					usedIPs[ip] = true
+					used = append(used, map[string]interface{}{
+						"ip":          ip,
+						"server_name": serverName,
+					})
+				}
+			}
+		}
+	}
+	var free []string
+	for _, ip := range hostIPs {
+		if ip != gateway && !usedIPs[ip] {
+			free = append(free, ip)
+		}
+	}
+
+	d.SetId(fmt.Sprintf("%s:%d", datacenter, subnetId))
+	d.Set("network", fullName)
+	d.Set("gateway", gateway)
+	d.Set("used", used)
+	d.Set("free", free)
+	return nil
+}
@@ -0,0 +1,106 @@
+package kamatera
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubnetHostIPs(t *testing.T) {
+	ips, err := subnetHostIPs("192.168.0.0", 29)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"192.168.0.1", "192.168.0.2", "192.168.0.3", "192.168.0.4", "192.168.0.5", "192.168.0.6",
+	}, ips)
+
+	ips, err = subnetHostIPs("172.16.0.0", 23)
+	assert.NoError(t, err)
+	assert.Len(t, ips, 510)
+	assert.Equal(t, "172.16.0.1", ips[0])
+	assert.Equal(t, "172.16.1.254", ips[len(ips)-1])
+
+	for _, tt := range []struct {
+		ip  string
+		bit int
+	}{
+		{"invalid", 24},
+		{"2001:db8::", 64},
+		{"10.0.0.0", 8},
+		{"10.0.0.0", 31},
+	} {
+		_, err := subnetHostIPs(tt.ip, tt.bit)
+		assert.Error(t, err, "Expected error for subnet %s/%d", tt.ip, tt.bit)
+	}
+}
+
+func TestDataSourceSubnetIpsRead(t *testing.T) {
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		switch path {
+		case "service/networks?datacenter=EU":
+			return []interface{}{
+				map[string]interface{}{"vlanId": 1.0, "names": []interface{}{"lan-12345-other-network"}},
+				map[string]interface{}{"vlanId": 2.0, "names": []interface{}{"lan-12345-my-network"}},
+			}, nil
+		case "service/network/subnets?datacenter=EU&vlanId=1":
+			return []interface{}{
+				map[string]interface{}{"subnetId": 10.0, "subnetIp": "192.168.0.0", "subnetBit": 29.0, "gateway": ""},
+			}, nil
+		case "service/network/subnets?datacenter=EU&vlanId=2":
+			return []interface{}{
+				map[string]interface{}{"subnetId": 20.0, "subnetIp": "172.16.0.0", "subnetBit": 29.0, "gateway": "172.16.0.1"},
+			}, nil
+		case "service/servers":
+			return []interface{}{
+				map[string]interface{}{"id": "1", "datacenter": "EU"},
+				map[string]interface{}{"id": "2", "datacenter": "EU"},
+				map[string]interface{}{"id": "3", "datacenter": "IL"},
+			}, nil
+		case "service/server/info":
+			switch body.(listServersPostValues).ID {
+			case "1":
+				return []interface{}{map[string]interface{}{"name": "web-1", "networks": []interface{}{
+					map[string]interface{}{"network": "wan-eu", "ips": []interface{}{"1.2.3.4"}},
+					map[string]interface{}{"network": "lan-12345-my-network", "ips": []interface{}{"172.16.0.3"}},
+				}}}, nil
+			case "2":
+				return []interface{}{map[string]interface{}{"name": "db-1", "networks": []interface{}{
+					map[string]interface{}{"network": "lan-12345-my-network", "ips": []interface{}{"172.16.0.2", "10.0.0.1"}},
+					// an IP from another network with the same range is not used in this subnet
+					map[string]interface{}{"network": "lan-12345-other-network", "ips": []interface{}{"172.16.0.4"}},
+				}}}, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	d := schema.TestResourceDataRaw(t, dataSourceSubnetIps().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"subnet_id":     20,
+	})
+	assert.Len(t, dataSourceSubnetIpsRead(context.Background(), d, &ProviderConfig{}), 0)
+	assert.Equal(t, "EU:20", d.Id())
+	assert.Equal(t, "lan-12345-my-network", d.Get("network"))
+	assert.Equal(t, "172.16.0.1", d.Get("gateway"))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"ip": "172.16.0.3", "server_name": "web-1"},
+		map[string]interface{}{"ip": "172.16.0.2", "server_name": "db-1"},
+	}, d.Get("used"))
+	// the gateway and the used IPs are not free
+	assert.Equal(t, []interface{}{"172.16.0.4", "172.16.0.5", "172.16.0.6"}, d.Get("free"))
+
+	d = schema.TestResourceDataRaw(t, dataSourceSubnetIps().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"subnet_id":     30,
+	})
+	diags := dataSourceSubnetIpsRead(context.Background(), d, &ProviderConfig{})
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "did not find subnet 30 in datacenter EU", diags[0].Summary)
+	}
+}
@@ -2,6 +2,7 @@ package kamatera
 
 import (
 	"fmt"
+	"sort"
 )
 
 type cannotParseDiskValuesErr struct {
@@ -81,3 +82,200 @@ func calDiskChangeOperation(o, n interface{}) (diskOperation, error) {
 	}
 	return op, nil
 }
+
+// calNamedDiskChangeOperation returns the operation to change the named disks from o to n. Disks are matched by
+// name, so removing a disk removes exactly that disk regardless of its position. It also returns the new disks with
+// their index after the operation: removing a disk shifts the index of the following disks and added disks are
+// attached after the existing disks. Update indexes in the operation refer to the disk positions after removal.
+func calNamedDiskChangeOperation(o, n []interface{}) (diskOperation, []interface{}, error) {
+	op := diskOperation{}
+
+	newNames := map[string]bool{}
+	for _, v := range n {
+		disk := v.(map[string]interface{})
+		name := disk["name"].(string)
+		if newNames[name] {
+			return diskOperation{}, nil, fmt.Errorf("duplicate disk name: %s", name)
+		}
+		newNames[name] = true
+	}
+
+	oldDisks := make([]map[string]interface{}, 0, len(o))
+	for _, v := range o {
+		oldDisks = append(oldDisks, v.(map[string]interface{}))
+	}
+	sort.SliceStable(oldDisks, func(i, j int) bool {
+		return oldDisks[i]["index"].(int) < oldDisks[j]["index"].(int)
+	})
+
+	oldDisksByName := map[string]map[string]interface{}{}
+	newIndexes := map[string]int{}
+	for _, disk := range oldDisks {
+		name := disk["name"].(string)
+		if name != "" && newNames[name] {
+			oldDisksByName[name] = disk
+			newIndexes[name] = len(newIndexes)
+		} else {
+			op.remove = append([]int{disk["index"].(int)}, op.remove...)
+		}
+	}
+
+	var newDisks []interface{}
+	for _, v := range n {
+		disk := v.(map[string]interface{})
+		name := disk["name"].(string)
+		size := disk["size_gb"].(int)
+		if oldDisk, ok := oldDisksByName[name]; ok {
+			if oldDisk["size_gb"].(int) != size {
+				if op.update == nil {
+					op.update = map[int]int{}
+				}
+				op.update[newIndexes[name]] = size
+			}
+		} else {
+			op.add = append(op.add, size)
+			newIndexes[name] = len(newIndexes)
+		}
+		newDisks = append(newDisks, map[string]interface{}{
+			"name":    name,
+			"size_gb": size,
+			"index":   newIndexes[name],
+		})
+	}
+	return op, newDisks, nil
+}
+
+// namedDisksFromSizes returns named disks for the existing disk sizes, the disks are named by position according
+// to the configured disks. It is used when the named disks are not in the state yet, after import or when changing
+// from disk_sizes_gb to disk blocks.
+func namedDisksFromSizes(diskSizes []interface{}, configuredDisks []interface{}) []interface{} {
+	var disks []interface{}
+	for i, size := range diskSizes {
+		name := ""
+		if i < len(configuredDisks) {
+			name = configuredDisks[i].(map[string]interface{})["name"].(string)
+		}
+		disks = append(disks, map[string]interface{}{
+			"name":    name,
+			"size_gb": size.(int),
+			"index":   i,
+		})
+	}
+	return disks
+}
+
+// namedDiskSizes returns the sizes of the named disks ordered by the disk index.
+func namedDiskSizes(disks []interface{}) []interface{} {
+	sizes := make([]interface{}, len(disks))
+	for _, v := range disks {
+		disk := v.(map[string]interface{})
+		sizes[disk["index"].(int)] = disk["size_gb"]
+	}
+	return sizes
+}
+
+// diskShrinks returns a description of each disk which the operation shrinks, the old disk sizes are ordered by
+// index. Update indexes refer to the disk positions after removal, so the removed disks are skipped.
+func diskShrinks(oldSizes []interface{}, op diskOperation) []string {
+	removed := map[int]bool{}
+	for _, index := range op.remove {
+		removed[index] = true
+	}
+	var sizes []int
+	var indexes []int
+	for i, size := range oldSizes {
+		if !removed[i] {
+			sizes = append(sizes, size.(int))
+			indexes = append(indexes, i)
+		}
+	}
+	var shrinks []string
+	for i, size := range sizes {
+		if newSize, ok := op.update[i]; ok && newSize < size {
+			shrinks = append(shrinks, fmt.Sprintf("disk at index %d from %d GB to %d GB", indexes[i], size, newSize))
+		}
+	}
+	return shrinks
+}
+
+type resourceChangeGetter interface {
+	GetChange(key string) (interface{}, interface{})
+	Id() string
+}
+
+// getServerNamedDiskChange returns the disk operation and the new disks for the server disk blocks. If the disks
+// are not in the state yet, the existing disks are matched to the configured disks by position.
+func getServerNamedDiskChange(d resourceChangeGetter) (diskOperation, []interface{}, error) {
+	_, n := d.GetChange("disk")
+	return calNamedDiskChangeOperation(getServerOldNamedDisks(d), n.([]interface{}))
+}
+
+// getServerOldNamedDisks returns the named disks from the state, or the existing disks matched to the configured
+// disks by position if the named disks are not in the state yet.
+func getServerOldNamedDisks(d resourceChangeGetter) []interface{} {
+	o, n := d.GetChange("disk")
+	oldDisks := o.([]interface{})
+	if len(oldDisks) == 0 && d.Id() != "" {
+		oldDiskSizes, _ := d.GetChange("disk_sizes_gb")
+		oldDisks = namedDisksFromSizes(oldDiskSizes.([]interface{}), n.([]interface{}))
+	}
+	return oldDisks
+}
+
+// applyNamedDiskOperation returns the named disks after the completed part of a disk operation, it is used to
+// record the actual disks when changeDisks fails. The disks which are in the new disks are ordered as the new
+// disks, followed by the disks which were not removed yet.
+func applyNamedDiskOperation(oldDisks, newDisks []interface{}, done diskOperation) []interface{} {
+	var disks []map[string]interface{}
+	oldNames := map[string]bool{}
+	for _, v := range oldDisks {
+		disk := v.(map[string]interface{})
+		oldNames[disk["name"].(string)] = true
+		disks = append(disks, map[string]interface{}{
+			"name":    disk["name"],
+			"size_gb": disk["size_gb"],
+			"index":   disk["index"],
+		})
+	}
+	sort.SliceStable(disks, func(i, j int) bool {
+		return disks[i]["index"].(int) < disks[j]["index"].(int)
+	})
+	for _, index := range done.remove {
+		disks = append(disks[:index], disks[index+1:]...)
+	}
+	for index, size := range done.update {
+		disks[index]["size_gb"] = size
+	}
+	added := 0
+	for _, v := range newDisks {
+		disk := v.(map[string]interface{})
+		if added < len(done.add) && !oldNames[disk["name"].(string)] {
+			disks = append(disks, map[string]interface{}{
+				"name":    disk["name"],
+				"size_gb": disk["size_gb"],
+			})
+			added++
+		}
+	}
+	for i, disk := range disks {
+		disk["index"] = i
+	}
+
+	var result []interface{}
+	inResult := map[string]bool{}
+	for _, v := range newDisks {
+		name := v.(map[string]interface{})["name"].(string)
+		for _, disk := range disks {
+			if disk["name"].(string) == name {
+				result = append(result, disk)
+				inResult[name] = true
+			}
+		}
+	}
+	for _, disk := range disks {
+		if !inResult[disk["name"].(string)] {
+			result = append(result, disk)
+		}
+	}
+	return result
+}
@@ -1,8 +1,12 @@
 package kamatera
 
 import (
+	"context"
+	"fmt"
+	"strconv"
 	"testing"
 
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -87,3 +91,206 @@ func Test_calDiskChangeOperation(t *testing.T) {
 		})
 	}
 }
+
+func namedDisk(name string, sizeGB int, index int) map[string]interface{} {
+	return map[string]interface{}{"name": name, "size_gb": sizeGB, "index": index}
+}
+
+func Test_calNamedDiskChangeOperation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		o             []interface{}
+		n             []interface{}
+		expected      diskOperation
+		expectedDisks []interface{}
+		expectedErr   string
+	}{
+		{
+			name:          "create",
+			n:             []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 0)},
+			expected:      diskOperation{add: []int{20, 50}},
+			expectedDisks: []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 1)},
+		},
+		{
+			name:          "remove middle disk",
+			o:             []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 1), namedDisk("logs", 30, 2)},
+			n:             []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 30, 2)},
+			expected:      diskOperation{remove: []int{1}},
+			expectedDisks: []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 30, 1)},
+		},
+		{
+			name:          "remove and resize following disk",
+			o:             []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 1), namedDisk("logs", 30, 2)},
+			n:             []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 40, 2)},
+			expected:      diskOperation{remove: []int{1}, update: map[int]int{1: 40}},
+			expectedDisks: []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 40, 1)},
+		},
+		{
+			name: "remove several disks from highest index",
+			o: []interface{}{
+				namedDisk("boot", 20, 0), namedDisk("a", 50, 1), namedDisk("b", 30, 2), namedDisk("c", 40, 3),
+			},
+			n:             []interface{}{namedDisk("boot", 20, 0), namedDisk("b", 30, 0)},
+			expected:      diskOperation{remove: []int{3, 1}},
+			expectedDisks: []interface{}{namedDisk("boot", 20, 0), namedDisk("b", 30, 1)},
+		},
+		{
+			name:          "add disk before existing disk in configuration",
+			o:             []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 1)},
+			n:             []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 30, 0), namedDisk("data", 50, 0)},
+			expected:      diskOperation{add: []int{30}},
+			expectedDisks: []interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 30, 2), namedDisk("data", 50, 1)},
+		},
+		{
+			name:        "duplicate name",
+			n:           []interface{}{namedDisk("boot", 20, 0), namedDisk("boot", 50, 0)},
+			expectedErr: "duplicate disk name: boot",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			actual, actualDisks, actualErr := calNamedDiskChangeOperation(test.o, test.n)
+			if test.expectedErr != "" {
+				assert.EqualError(t, actualErr, test.expectedErr)
+				return
+			}
+			assert.NoError(t, actualErr)
+			assert.Equal(t, test.expected, actual)
+			assert.Equal(t, test.expectedDisks, actualDisks)
+		})
+	}
+}
+
+func TestNamedDisksFromSizes(t *testing.T) {
+	disks := namedDisksFromSizes(
+		[]interface{}{20, 50, 30},
+		[]interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 0)},
+	)
+	assert.Equal(t, []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 50, 1), namedDisk("", 30, 2)}, disks)
+	assert.Equal(t, []interface{}{20, 50, 30}, namedDiskSizes(disks))
+}
+
+func TestResourceServerCustomizeDiffDisks(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"datacenter_id": "EU",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+	}
+	diff, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", diff.Attributes["disk_sizes_gb.#"].New)
+	assert.Equal(t, "10", diff.Attributes["disk_sizes_gb.0"].New)
+
+	config["disk"] = []interface{}{
+		map[string]interface{}{"name": "boot", "size_gb": 20},
+		map[string]interface{}{"name": "data", "size_gb": 50},
+	}
+	diff, err = resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", diff.Attributes["disk_sizes_gb.#"].New)
+	assert.Equal(t, "20", diff.Attributes["disk_sizes_gb.0"].New)
+	assert.Equal(t, "50", diff.Attributes["disk_sizes_gb.1"].New)
+
+	config["disk_sizes_gb"] = []interface{}{20}
+	diags := resourceServer().Validate(terraform.NewResourceConfigRaw(config))
+	assert.True(t, diags.HasError())
+}
+
+func TestDiskShrinks(t *testing.T) {
+	assert.Nil(t, diskShrinks([]interface{}{20, 50}, diskOperation{update: map[int]int{1: 60}}))
+	assert.Equal(t, []string{"disk at index 1 from 50 GB to 30 GB"},
+		diskShrinks([]interface{}{20, 50}, diskOperation{update: map[int]int{1: 30}}))
+	// update indexes refer to the positions after removal
+	assert.Equal(t, []string{"disk at index 2 from 50 GB to 30 GB"},
+		diskShrinks([]interface{}{20, 40, 50}, diskOperation{remove: []int{1}, update: map[int]int{1: 30}}))
+}
+
+func TestResourceServerCustomizeDiffDiskChanges(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	stateAttributes := map[string]string{
+		"id":              "my-server",
+		"name":            "my-server",
+		"datacenter_id":   "EU",
+		"image_id":        "EU:ubuntu",
+		"cpu_type":        "B",
+		"cpu_cores":       "2",
+		"ram_mb":          "2048",
+		"disk_sizes_gb.#": "3",
+		"disk_sizes_gb.0": "20",
+		"disk_sizes_gb.1": "50",
+		"disk_sizes_gb.2": "50",
+		"billing_cycle":   "hourly",
+		"power_on":        "true",
+	}
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"datacenter_id": "EU",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20, 50, 20},
+	}
+	diff := func() (*terraform.InstanceDiff, error) {
+		return resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+	}
+
+	_, err := diff()
+	assert.EqualError(t, err, "disks can't be shrunk: disk at index 2 from 50 GB to 20 GB, set allow_recreate to true to recreate the server")
+
+	config["allow_recreate"] = true
+	d, err := diff()
+	assert.NoError(t, err)
+	assert.True(t, d.RequiresNew())
+	delete(config, "allow_recreate")
+
+	config["disk_sizes_gb"] = []interface{}{20, 50, 100}
+	d, err = diff()
+	assert.NoError(t, err)
+	assert.False(t, d.RequiresNew())
+
+	config["disk_sizes_gb"] = []interface{}{20, 50}
+	_, err = diff()
+	assert.EqualError(t, err, "removing disks at index 2 deletes their data, set allow_disk_removal to true to allow it")
+
+	config["allow_disk_removal"] = true
+	_, err = diff()
+	assert.NoError(t, err)
+
+	delete(config, "disk_sizes_gb")
+	config["disk"] = []interface{}{
+		map[string]interface{}{"name": "data", "size_gb": 50},
+		map[string]interface{}{"name": "logs", "size_gb": 50},
+	}
+	stateAttributes["disk.#"] = "3"
+	for i, name := range []string{"boot", "data", "logs"} {
+		stateAttributes[fmt.Sprintf("disk.%d.name", i)] = name
+		stateAttributes[fmt.Sprintf("disk.%d.size_gb", i)] = stateAttributes[fmt.Sprintf("disk_sizes_gb.%d", i)]
+		stateAttributes[fmt.Sprintf("disk.%d.index", i)] = strconv.Itoa(i)
+	}
+	_, err = diff()
+	assert.EqualError(t, err, "the boot disk at index 0 can't be removed")
+
+	config["disk"] = []interface{}{
+		map[string]interface{}{"name": "boot", "size_gb": 20},
+		map[string]interface{}{"name": "logs", "size_gb": 50},
+	}
+	d, err = diff()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", d.Attributes["disk_sizes_gb.#"].New)
+	assert.False(t, d.RequiresNew())
+
+	config["allow_disk_removal"] = false
+	_, err = diff()
+	assert.EqualError(t, err, "removing disks at index 1 deletes their data, set allow_disk_removal to true to allow it")
+}
@@ -1,5 +1,25 @@
 package kamatera
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var noProviderErr = errors.New("no provider")
+
+// apiError is an error response from the Kamatera API.
+type apiError struct {
+	statusCode int
+	result     interface{}
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("error response from Kamatera API (%d): %+v", e.statusCode, e.result)
+}
+
+// isRejectedRequest returns true if the API rejected the request, for example because the requested change is not
+// supported or not valid, in which case the request was not applied.
+func isRejectedRequest(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && e.statusCode >= 400 && e.statusCode < 500
+}
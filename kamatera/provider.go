@@ -2,6 +2,7 @@ package kamatera
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -11,6 +12,10 @@ type ProviderConfig struct {
 	ApiUrl      string
 	ApiClientID string
 	ApiSecret   string
+
+	DefaultDatacenterId string
+
+	catalogCache *catalogCache
 }
 
 // Provider -
@@ -21,8 +26,14 @@ func Provider() *schema.Provider {
 			"kamatera_network": resourceNetwork(),
 		},
 		DataSourcesMap: map[string]*schema.Resource{
-			"kamatera_datacenter": dataSourceDatacenter(),
-			"kamatera_image":      dataSourceImage(),
+			"kamatera_datacenter":     dataSourceDatacenter(),
+			"kamatera_datacenters":    dataSourceDatacenters(),
+			"kamatera_image":          dataSourceImage(),
+			"kamatera_images":         dataSourceImages(),
+			"kamatera_server_options": dataSourceServerOptions(),
+			"kamatera_server_price":   dataSourceServerPrice(),
+			"kamatera_servers":        dataSourceServers(),
+			"kamatera_subnet_ips":     dataSourceSubnetIps(),
 		},
 		Schema: map[string]*schema.Schema{
 			"api_client_id": {
@@ -44,6 +55,11 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("KAMATERA_API_URL", "https://cloudcli.cloudwm.com"),
 				Description: "Kamatera API Url",
 			},
+			"default_datacenter_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "Datacenter ID to use for resources and data sources which don't set datacenter_id",
+			},
 		},
 		ConfigureContextFunc: providerConfigure,
 	}
@@ -58,5 +74,42 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 		ApiUrl:      apiURL,
 		ApiClientID: apiClientID,
 		ApiSecret:   apiSecret,
+
+		DefaultDatacenterId: d.Get("default_datacenter_id").(string),
+
+		catalogCache: newCatalogCache(),
 	}, nil
 }
+
+var noDatacenterIdErr = fmt.Errorf("datacenter_id is not set, set it or set the provider default_datacenter_id")
+
+// getDatacenterIdOrDefault returns the datacenter_id of a data source, or the provider default_datacenter_id if not set.
+func getDatacenterIdOrDefault(d *schema.ResourceData, m interface{}) (string, error) {
+	if datacenterId := d.Get("datacenter_id").(string); datacenterId != "" {
+		return datacenterId, nil
+	}
+	if provider, ok := m.(*ProviderConfig); ok && provider != nil && provider.DefaultDatacenterId != "" {
+		return provider.DefaultDatacenterId, nil
+	}
+	return "", noDatacenterIdErr
+}
+
+// customizeDiffDefaultDatacenterId plans the provider default_datacenter_id for resources which don't set datacenter_id.
+func customizeDiffDefaultDatacenterId(d *schema.ResourceDiff, m interface{}) error {
+	rawConfig := d.GetRawConfig()
+	if rawConfig.IsNull() || !rawConfig.IsKnown() {
+		if d.Get("datacenter_id").(string) != "" {
+			return nil
+		}
+	} else if !rawConfig.GetAttr("datacenter_id").IsNull() {
+		return nil
+	}
+	provider, ok := m.(*ProviderConfig)
+	if !ok || provider == nil || provider.DefaultDatacenterId == "" {
+		return noDatacenterIdErr
+	}
+	if d.Get("datacenter_id").(string) == provider.DefaultDatacenterId {
+		return nil
+	}
+	return d.SetNew("datacenter_id", provider.DefaultDatacenterId)
+}
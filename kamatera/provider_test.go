@@ -0,0 +1,64 @@
+package kamatera
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvider(t *testing.T) {
+	assert.NoError(t, Provider().InternalValidate())
+}
+
+func TestGetDatacenterIdOrDefault(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceImages().Schema, map[string]interface{}{})
+	_, err := getDatacenterIdOrDefault(d, &ProviderConfig{})
+	assert.Equal(t, noDatacenterIdErr, err)
+
+	datacenterId, err := getDatacenterIdOrDefault(d, &ProviderConfig{DefaultDatacenterId: "EU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "EU", datacenterId)
+
+	d = schema.TestResourceDataRaw(t, dataSourceImages().Schema, map[string]interface{}{"datacenter_id": "IL"})
+	datacenterId, err = getDatacenterIdOrDefault(d, &ProviderConfig{DefaultDatacenterId: "EU"})
+	assert.NoError(t, err)
+	assert.Equal(t, "IL", datacenterId)
+}
+
+func TestResourceServerCustomizeDiffDefaults(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20},
+	}
+	_, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), &ProviderConfig{})
+	assert.Equal(t, noDatacenterIdErr, err)
+
+	provider := &ProviderConfig{
+		catalogCache:        newCatalogCache(),
+		DefaultDatacenterId: "EU",
+	}
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		return []interface{}{}, nil
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+	diff, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "EU", diff.Attributes["datacenter_id"].New)
+
+	config["datacenter_id"] = "IL"
+	diff, err = resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), provider)
+	assert.NoError(t, err)
+	assert.Equal(t, "IL", diff.Attributes["datacenter_id"].New)
+}
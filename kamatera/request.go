@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
 	"strconv"
 	"time"
 
@@ -49,7 +51,7 @@ func request(provider *ProviderConfig, method string, path string, body interfac
 		}
 	}
 	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("error response from Kamatera API (%d): %+v", res.StatusCode, result)
+		return nil, &apiError{statusCode: res.StatusCode, result: result}
 	}
 	return result, nil
 }
@@ -57,18 +59,26 @@ func request(provider *ProviderConfig, method string, path string, body interfac
 var mockableRequest = request
 
 func postServerConfigure(provider *ProviderConfig, postValues configureServerPostValues) error {
-	if provider == nil {
-		return noProviderErr
-	}
-
-	result, err := request(provider, "POST", "server/configure", postValues)
+	result, err := mockableRequest(provider, "POST", "server/configure", postValues)
 	if err != nil {
 		return err
 	}
 
-	commandIds := result.([]interface{})
-	_, err = waitCommand(provider, commandIds[0].(string))
-	return err
+	// the configure call returns a command for each changed option
+	commandIds, ok := result.([]interface{})
+	if !ok || len(commandIds) == 0 {
+		return fmt.Errorf("invalid response from Kamatera API: %+v", result)
+	}
+	for _, commandId := range commandIds {
+		commandId, ok := commandId.(string)
+		if !ok {
+			return fmt.Errorf("invalid response from Kamatera API: %+v", result)
+		}
+		if _, err := waitCommand(provider, commandId); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func serverChangePassword(provider *ProviderConfig, internalServerID string, password string) error {
@@ -118,66 +128,127 @@ func getCommandIdFromResult(result interface{}) string {
 	return commandId
 }
 
-func changeDisks(provider *ProviderConfig, id string, operation diskOperation) error {
-	if len(operation.add) > 0 {
-		for _, v := range operation.add {
-			result, err := mockableRequest(
-				provider,
-				"POST",
-				"server/disk",
-				changeDisksPostValues{
-					ID:  id,
-					Add: fmt.Sprintf("%vgb", v),
-				},
-			)
-			if err != nil {
-				return err
+// changeDisks applies the disk operation one disk at a time: disks are removed from the highest index down, so the
+// indexes of the remaining disks don't shift, then resized in index order and then the new disks are added.
+// The server is read after each step to verify the change. It returns the completed operation and the last read
+// disk sizes, so that the caller can record the actual state of the server if a step fails.
+func changeDisks(provider *ProviderConfig, id string, operation diskOperation) (diskOperation, []int, error) {
+	done := diskOperation{}
+	server, err := getServerInfo(provider, id)
+	if err != nil {
+		return done, nil, err
+	}
+	diskSizes := getServerDiskSizes(server)
+
+	step := func(body changeDisksPostValues, expected []int) (bool, error) {
+		result, err := mockableRequest(provider, "POST", "server/disk", body)
+		if err != nil {
+			return false, err
+		}
+		_, waitErr := waitCommand(provider, getCommandIdFromResult(result))
+		server, err := getServerInfo(provider, id)
+		if err != nil {
+			if waitErr != nil {
+				return false, waitErr
 			}
+			return false, err
+		}
+		diskSizes = getServerDiskSizes(server)
+		applied := reflect.DeepEqual(diskSizes, expected)
+		if waitErr != nil {
+			return applied, waitErr
+		} else if !applied {
+			return false, fmt.Errorf("unexpected disk sizes after the change: expected %v, got %v", expected, diskSizes)
+		}
+		return true, nil
+	}
 
-			_, err = waitCommand(provider, getCommandIdFromResult(result))
+	remove := append([]int{}, operation.remove...)
+	sort.Sort(sort.Reverse(sort.IntSlice(remove)))
+	for _, index := range remove {
+		if index >= len(diskSizes) {
+			return done, diskSizes, fmt.Errorf("failed to remove disk at index %d: the server has %d disks", index, len(diskSizes))
+		}
+		expected := append(append([]int{}, diskSizes[:index]...), diskSizes[index+1:]...)
+		applied, err := step(changeDisksPostValues{ID: id, Remove: fmt.Sprint(index)}, expected)
+		if applied {
+			done.remove = append(done.remove, index)
+		}
+		if err != nil {
+			return done, diskSizes, fmt.Errorf("failed to remove disk at index %d: %w", index, err)
 		}
 	}
 
-	if len(operation.remove) > 0 {
-		for _, v := range operation.remove {
-			result, err := mockableRequest(
-				provider,
-				"POST",
-				"server/disk",
-				changeDisksPostValues{
-					ID:     id,
-					Remove: fmt.Sprint(v),
-				},
-			)
-			if err != nil {
-				return err
+	var resize []int
+	for index := range operation.update {
+		resize = append(resize, index)
+	}
+	sort.Ints(resize)
+	for _, index := range resize {
+		size := operation.update[index]
+		if index >= len(diskSizes) {
+			return done, diskSizes, fmt.Errorf("failed to resize disk at index %d: the server has %d disks", index, len(diskSizes))
+		}
+		expected := append([]int{}, diskSizes...)
+		expected[index] = size
+		applied, err := step(changeDisksPostValues{ID: id, Resize: fmt.Sprint(index), Size: fmt.Sprintf("%vgb", size)}, expected)
+		if applied {
+			if done.update == nil {
+				done.update = map[int]int{}
 			}
+			done.update[index] = size
+		}
+		if err != nil {
+			return done, diskSizes, fmt.Errorf("failed to resize disk at index %d to %d GB: %w", index, size, err)
+		}
+	}
 
-			_, err = waitCommand(provider, getCommandIdFromResult(result))
+	for _, size := range operation.add {
+		expected := append(append([]int{}, diskSizes...), size)
+		applied, err := step(changeDisksPostValues{ID: id, Add: fmt.Sprintf("%vgb", size)}, expected)
+		if applied {
+			done.add = append(done.add, size)
+		}
+		if err != nil {
+			return done, diskSizes, fmt.Errorf("failed to add %d GB disk: %w", size, err)
 		}
 	}
 
-	if len(operation.update) > 0 {
-		for key, val := range operation.update {
-			result, err := mockableRequest(
-				provider,
-				"POST",
-				"server/disk",
-				changeDisksPostValues{
-					ID:     id,
-					Resize: fmt.Sprint(key),
-					Size:   fmt.Sprintf("%vgb", val),
-				},
-			)
-			if err != nil {
-				return err
-			}
+	return done, diskSizes, nil
+}
 
-			_, err = waitCommand(provider, getCommandIdFromResult(result))
+// getServerDiskSizes returns the disk sizes in GB from the server info.
+func getServerDiskSizes(server map[string]interface{}) []int {
+	var diskSizes []int
+	for _, v := range server["diskSizes"].([]interface{}) {
+		switch v := v.(type) {
+		case int:
+			diskSizes = append(diskSizes, v)
+		case float64:
+			diskSizes = append(diskSizes, int(v))
 		}
 	}
+	return diskSizes
+}
 
-	return nil
+func listServers(provider *ProviderConfig) ([]interface{}, error) {
+	result, err := mockableRequest(provider, "GET", "service/servers", nil)
+	if err != nil {
+		return nil, err
+	}
+	return result.([]interface{}), nil
+}
+
+func getServerInfo(provider *ProviderConfig, internalServerID string) (map[string]interface{}, error) {
+	result, err := mockableRequest(provider, "POST", "service/server/info", listServersPostValues{ID: internalServerID})
+	if err != nil {
+		return nil, err
+	}
+	servers := result.([]interface{})
+	if len(servers) != 1 {
+		return nil, fmt.Errorf("failed to find server %s", internalServerID)
+	}
+	return servers[0].(map[string]interface{}), nil
 }
 
 func waitCommand(provider *ProviderConfig, commandID string) (map[string]interface{}, error) {
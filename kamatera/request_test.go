@@ -1,11 +1,48 @@
 package kamatera
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// mockDisksServer mocks the server disk requests, the disk changes are applied to the disk sizes except for the
+// change number ignoredChange, which is accepted but not applied.
+type mockDisksServer struct {
+	diskSizes     []interface{}
+	bodies        []changeDisksPostValues
+	ignoredChange int
+}
+
+func (s *mockDisksServer) request(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+	switch path {
+	case "service/server/info":
+		return []interface{}{map[string]interface{}{"diskSizes": append([]interface{}{}, s.diskSizes...)}}, nil
+	case "server/disk":
+		body := body.(changeDisksPostValues)
+		s.bodies = append(s.bodies, body)
+		if len(s.bodies) == s.ignoredChange {
+			return []interface{}{""}, nil
+		}
+		if body.Add != "" {
+			size, _ := strconv.Atoi(strings.TrimSuffix(body.Add, "gb"))
+			s.diskSizes = append(s.diskSizes, float64(size))
+		} else if body.Remove != "" {
+			index, _ := strconv.Atoi(body.Remove)
+			s.diskSizes = append(s.diskSizes[:index], s.diskSizes[index+1:]...)
+		} else {
+			index, _ := strconv.Atoi(body.Resize)
+			size, _ := strconv.Atoi(strings.TrimSuffix(body.Size, "gb"))
+			s.diskSizes[index] = float64(size)
+		}
+		return []interface{}{""}, nil
+	}
+	return nil, fmt.Errorf("unexpected request: %s", path)
+}
+
 func Test_changeDisks(t *testing.T) {
 	skipWaiting = true
 	defer func() {
@@ -13,33 +50,40 @@ func Test_changeDisks(t *testing.T) {
 	}()
 
 	tests := []struct {
-		name     string
-		op       diskOperation
-		expected []changeDisksPostValues
+		name              string
+		diskSizes         []interface{}
+		op                diskOperation
+		expected          []changeDisksPostValues
+		expectedDiskSizes []int
 	}{
 		{
-			name: "add only",
-			op:   diskOperation{add: []int{10}},
+			name:      "add only",
+			diskSizes: []interface{}{20.0},
+			op:        diskOperation{add: []int{10}},
 			expected: []changeDisksPostValues{
 				{
 					ID:  "1",
 					Add: "10gb",
 				},
 			},
+			expectedDiskSizes: []int{20, 10},
 		},
 		{
-			name: "remove only",
-			op:   diskOperation{remove: []int{1}},
+			name:      "remove only",
+			diskSizes: []interface{}{20.0, 10.0},
+			op:        diskOperation{remove: []int{1}},
 			expected: []changeDisksPostValues{
 				{
 					ID:     "1",
 					Remove: "1",
 				},
 			},
+			expectedDiskSizes: []int{20},
 		},
 		{
-			name: "update only",
-			op:   diskOperation{update: map[int]int{1: 10}},
+			name:      "update only",
+			diskSizes: []interface{}{20.0, 20.0},
+			op:        diskOperation{update: map[int]int{1: 10}},
 			expected: []changeDisksPostValues{
 				{
 					ID:     "1",
@@ -47,29 +91,54 @@ func Test_changeDisks(t *testing.T) {
 					Size:   "10gb",
 				},
 			},
+			expectedDiskSizes: []int{20, 10},
 		},
 		{
-			name: "update and add",
+			name:      "update and add",
+			diskSizes: []interface{}{20.0, 20.0},
 			op: diskOperation{
 				add:    []int{20},
 				update: map[int]int{1: 10},
 			},
 			expected: []changeDisksPostValues{
+				{
+					ID:     "1",
+					Resize: "1",
+					Size:   "10gb",
+				},
 				{
 					ID:  "1",
 					Add: "20gb",
 				},
+			},
+			expectedDiskSizes: []int{20, 10, 20},
+		},
+		{
+			name:      "update and remove",
+			diskSizes: []interface{}{20.0, 20.0},
+			op:        diskOperation{remove: []int{1}, update: map[int]int{0: 10}},
+			expected: []changeDisksPostValues{
 				{
 					ID:     "1",
-					Resize: "1",
+					Remove: "1",
+				},
+				{
+					ID:     "1",
+					Resize: "0",
 					Size:   "10gb",
 				},
 			},
+			expectedDiskSizes: []int{10},
 		},
 		{
-			name: "update and remove",
-			op:   diskOperation{remove: []int{1}, update: map[int]int{0: 10}},
+			name:      "remove from highest index and resize in index order",
+			diskSizes: []interface{}{20.0, 30.0, 40.0, 50.0},
+			op:        diskOperation{remove: []int{1, 3}, update: map[int]int{1: 100, 0: 50}},
 			expected: []changeDisksPostValues{
+				{
+					ID:     "1",
+					Remove: "3",
+				},
 				{
 					ID:     "1",
 					Remove: "1",
@@ -77,9 +146,15 @@ func Test_changeDisks(t *testing.T) {
 				{
 					ID:     "1",
 					Resize: "0",
-					Size:   "10gb",
+					Size:   "50gb",
+				},
+				{
+					ID:     "1",
+					Resize: "1",
+					Size:   "100gb",
 				},
 			},
+			expectedDiskSizes: []int{50, 100},
 		},
 	}
 
@@ -87,24 +162,57 @@ func Test_changeDisks(t *testing.T) {
 		test := test
 
 		t.Run(test.name, func(t *testing.T) {
-			called := 0
-			var bodies []changeDisksPostValues
+			server := &mockDisksServer{diskSizes: test.diskSizes}
 			prevRequest := mockableRequest
-			// request is mocked to return only body payload
-			mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
-				called += 1
-				bodies = append(bodies, body.(changeDisksPostValues))
-				return []interface{}{""}, nil
-			}
+			mockableRequest = server.request
 			defer func() {
 				mockableRequest = prevRequest
 			}()
 
-			err := changeDisks(nil, "1", test.op)
+			done, diskSizes, err := changeDisks(nil, "1", test.op)
 
 			assert.Nil(t, err)
-			assert.Equal(t, len(test.expected), called)
-			assert.Equal(t, test.expected, bodies)
+			assert.Equal(t, test.expected, server.bodies)
+			assert.Equal(t, test.expectedDiskSizes, diskSizes)
+			assert.Equal(t, len(test.op.add), len(done.add))
+			assert.Equal(t, len(test.op.remove), len(done.remove))
+			assert.Equal(t, len(test.op.update), len(done.update))
 		})
 	}
 }
+
+func Test_changeDisksPartialFailure(t *testing.T) {
+	skipWaiting = true
+	defer func() {
+		skipWaiting = false
+	}()
+
+	server := &mockDisksServer{diskSizes: []interface{}{20.0, 30.0, 40.0}, ignoredChange: 2}
+	prevRequest := mockableRequest
+	mockableRequest = server.request
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	done, diskSizes, err := changeDisks(nil, "1", diskOperation{remove: []int{1}, update: map[int]int{0: 50, 1: 50}})
+	assert.EqualError(t, err, "failed to resize disk at index 0 to 50 GB: unexpected disk sizes after the change: "+
+		"expected [50 40], got [20 40]")
+	assert.Equal(t, diskOperation{remove: []int{1}}, done)
+	assert.Equal(t, []int{20, 40}, diskSizes)
+	assert.Len(t, server.bodies, 2)
+
+	oldDisks := []interface{}{namedDisk("boot", 20, 0), namedDisk("data", 30, 1), namedDisk("logs", 40, 2)}
+	newDisks := []interface{}{namedDisk("boot", 50, 0), namedDisk("logs", 50, 1)}
+	assert.Equal(t,
+		[]interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 40, 1)},
+		applyNamedDiskOperation(oldDisks, newDisks, done),
+	)
+	assert.Equal(t,
+		[]interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 40, 2), namedDisk("data", 30, 1)},
+		applyNamedDiskOperation(oldDisks, newDisks, diskOperation{}),
+	)
+	assert.Equal(t,
+		[]interface{}{namedDisk("boot", 20, 0), namedDisk("logs", 40, 2), namedDisk("new", 10, 3), namedDisk("data", 30, 1)},
+		applyNamedDiskOperation(oldDisks, append(newDisks, namedDisk("new", 10, 0)), diskOperation{add: []int{10}}),
+	)
+}
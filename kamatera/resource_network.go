@@ -3,6 +3,7 @@ package kamatera
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -56,6 +57,7 @@ type delSubnetPostValues struct {
 
 func resourceNetwork() *schema.Resource {
 	return &schema.Resource{
+		CustomizeDiff: resourceNetworkCustomizeDiff,
 		CreateContext: resourceNetworkCreate,
 		ReadContext:   resourceNetworkRead,
 		UpdateContext: resourceNetworkUpdate,
@@ -68,7 +70,7 @@ func resourceNetwork() *schema.Resource {
 			"name": {
 				Type:        schema.TypeString,
 				Required:    true,
-				Description: "The network name.",
+				Description: "The network name. Changing the name replaces the network.",
 				ValidateFunc: validation.All(
 					validation.StringLenBetween(3, 20),
 					validation.StringMatch(regexp.MustCompile(`^[a-z0-9-.]+$`), "must contain only lowercase letters, digits, dashes (-) and dots (.)"),
@@ -81,9 +83,11 @@ func resourceNetwork() *schema.Resource {
 					" This value should be used when attaching a network to a server.",
 			},
 			"datacenter_id": {
-				Type:        schema.TypeString,
-				Required:    true,
-				Description: "id attribute of datacenter data source",
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				Description: "id attribute of datacenter data source. If not set, the provider default_datacenter_id is used. " +
+					"Changing the datacenter replaces the network.",
 			},
 			"subnet": {
 				Type:        schema.TypeList,
@@ -135,10 +139,91 @@ func resourceNetwork() *schema.Resource {
 				Type:     schema.TypeInt,
 				Computed: true,
 			},
+			"force_detach": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Deprecated: "The provider can't detach a network from servers, detach the network from the attached " +
+					"servers before deleting it.",
+				Description: "The network is not deleted while servers are attached to it, the attached servers are " +
+					"listed in the error. The provider can't detach the network from the servers, so setting " +
+					"force_detach doesn't delete an attached network either.",
+			},
 		},
 	}
 }
 
+type networkAttachedServer struct {
+	id             string
+	name           string
+	networkIndexes []int
+}
+
+func findNetworkAttachedServers(servers []map[string]interface{}, fullName string) []networkAttachedServer {
+	var attachedServers []networkAttachedServer
+	for _, server := range servers {
+		var networkIndexes []int
+		networks, _ := server["networks"].([]interface{})
+		for i, network := range networks {
+			network, _ := network.(map[string]interface{})
+			if name, _ := network["network"].(string); name == fullName {
+				networkIndexes = append(networkIndexes, i)
+			}
+		}
+		if len(networkIndexes) > 0 {
+			id, _ := server["id"].(string)
+			name, _ := server["name"].(string)
+			attachedServers = append(attachedServers, networkAttachedServer{
+				id:             id,
+				name:           name,
+				networkIndexes: networkIndexes,
+			})
+		}
+	}
+	return attachedServers
+}
+
+func getDatacenterServersInfo(provider *ProviderConfig, datacenter string) ([]map[string]interface{}, error) {
+	servers, err := listServers(provider)
+	if err != nil {
+		return nil, err
+	}
+	var serversInfo []map[string]interface{}
+	for _, server := range servers {
+		server, _ := server.(map[string]interface{})
+		if serverDatacenter, _ := server["datacenter"].(string); serverDatacenter != datacenter {
+			continue
+		}
+		id, _ := server["id"].(string)
+		serverInfo, err := getServerInfo(provider, id)
+		if err != nil {
+			return nil, err
+		}
+		serversInfo = append(serversInfo, serverInfo)
+	}
+	return serversInfo, nil
+}
+
+// resourceNetworkCustomizeDiff plans a replacement when the network name or datacenter changes, the Kamatera
+// API does not support renaming or moving a network. Servers attach to the network by its full_name, so they
+// will see the new full_name as unknown in the same plan.
+func resourceNetworkCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if err := customizeDiffDefaultDatacenterId(d, m); err != nil {
+		return err
+	}
+	if d.Id() == "" {
+		return nil
+	}
+	for _, key := range []string{"name", "datacenter_id"} {
+		if d.HasChange(key) {
+			if err := d.ForceNew(key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func resourceNetworkCreate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
 	provider := m.(*ProviderConfig)
 	subnets := d.Get("subnet").([]interface{})
@@ -252,12 +337,6 @@ func resourceNetworkRead(ctx context.Context, d *schema.ResourceData, m interfac
 
 func resourceNetworkUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
 	provider := m.(*ProviderConfig)
-	if d.HasChange("name") {
-		return diag.Errorf("changing network name is not supported")
-	}
-	if d.HasChange("datacenter_id") {
-		return diag.Errorf("changing network datacenter is not supported")
-	}
 	if d.HasChange("subnet") {
 		oldSubnets, newSubnets := d.GetChange("subnet")
 		newSubnetsByDescription := make(map[string]map[string]interface{})
@@ -305,6 +384,31 @@ func resourceNetworkUpdate(ctx context.Context, d *schema.ResourceData, m interf
 
 func resourceNetworkDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	provider := m.(*ProviderConfig)
+	serversInfo, err := getDatacenterServersInfo(provider, d.Get("datacenter_id").(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	attachedServers := findNetworkAttachedServers(serversInfo, d.Get("full_name").(string))
+	if len(attachedServers) > 0 {
+		var serverNames []string
+		for _, server := range attachedServers {
+			serverNames = append(serverNames, server.name)
+		}
+		if d.Get("force_detach").(bool) {
+			return diag.Errorf(
+				"cannot delete network %s, it is attached to the following servers: %s. "+
+					"force_detach is not supported, the provider can't detach the network from servers. Remove the "+
+					"network from the servers network blocks or detach it in the Kamatera console, then delete the network",
+				d.Get("full_name").(string), strings.Join(serverNames, ", "),
+			)
+		}
+		return diag.Errorf(
+			"cannot delete network %s, it is attached to the following servers: %s. "+
+				"Remove the network from the servers network blocks or detach it in the Kamatera console, "+
+				"then delete the network",
+			d.Get("full_name").(string), strings.Join(serverNames, ", "),
+		)
+	}
 	for _, subnet := range d.Get("subnet").([]interface{}) {
 		err := delSubnet(provider, d, subnet.(map[string]interface{}))
 		if err != nil {
@@ -315,7 +419,7 @@ func resourceNetworkDelete(ctx context.Context, d *schema.ResourceData, m interf
 		Datacenter: d.Get("datacenter_id").(string),
 		Id:         d.Get("network_id").(int),
 	}
-	_, err := request(provider, "POST", "service/network/delete", body)
+	_, err = mockableRequest(provider, "POST", "service/network/delete", body)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -332,7 +436,7 @@ func resourceNetworkImport(ctx context.Context, d *schema.ResourceData, m interf
 		for i := range diags {
 			errorMessages = append(errorMessages, diags[i].Summary)
 		}
-		return nil, fmt.Errorf(strings.Join(errorMessages, ", "))
+		return nil, errors.New(strings.Join(errorMessages, ", "))
 	}
 	return []*schema.ResourceData{d}, nil
 }
@@ -368,7 +472,7 @@ func delSubnet(provider *ProviderConfig, d *schema.ResourceData, subnet map[stri
 	body := &delSubnetPostValues{
 		SubnetId: subnet["id"].(int),
 	}
-	_, err := request(provider, "POST", "service/network/subnet/delete", body)
+	_, err := mockableRequest(provider, "POST", "service/network/subnet/delete", body)
 	if err != nil {
 		return diag.FromErr(err)
 	}
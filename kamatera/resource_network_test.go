@@ -1,6 +1,10 @@
 package kamatera
 
 import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -36,3 +40,144 @@ func TestNetworkResourceSchema(t *testing.T) {
 		})
 	}
 }
+
+func TestFindNetworkAttachedServers(t *testing.T) {
+	servers := []map[string]interface{}{
+		{
+			"id":   "1",
+			"name": "server1",
+			"networks": []interface{}{
+				map[string]interface{}{"network": "wan-eu", "ips": []interface{}{"1.2.3.4"}},
+				map[string]interface{}{"network": "lan-12345-my-network", "ips": []interface{}{"172.16.0.10"}},
+			},
+		},
+		{
+			"id":   "2",
+			"name": "server2",
+			"networks": []interface{}{
+				map[string]interface{}{"network": "wan-eu", "ips": []interface{}{"1.2.3.5"}},
+			},
+		},
+		{
+			"id":   "3",
+			"name": "server3",
+			"networks": []interface{}{
+				map[string]interface{}{"network": "lan-12345-my-network", "ips": []interface{}{"172.16.0.11"}},
+				map[string]interface{}{"network": "lan-12345-other-network", "ips": []interface{}{"10.0.0.11"}},
+				map[string]interface{}{"network": "lan-12345-my-network", "ips": []interface{}{"172.16.0.12"}},
+			},
+		},
+	}
+	assert.Equal(t, []networkAttachedServer{
+		{id: "1", name: "server1", networkIndexes: []int{1}},
+		{id: "3", name: "server3", networkIndexes: []int{0, 2}},
+	}, findNetworkAttachedServers(servers, "lan-12345-my-network"))
+	assert.Len(t, findNetworkAttachedServers(servers, "lan-12345-unknown"), 0)
+
+	// null fields don't match
+	assert.Len(t, findNetworkAttachedServers([]map[string]interface{}{
+		{"id": nil, "name": nil, "networks": []interface{}{map[string]interface{}{"network": nil}, nil}},
+	}, "lan-12345-my-network"), 0)
+}
+
+func TestNetworkResourceDelete(t *testing.T) {
+	var paths []string
+	serversInfo := map[string]map[string]interface{}{
+		"1": {"id": "1", "name": "server1", "networks": []interface{}{
+			map[string]interface{}{"network": "wan-eu"},
+			map[string]interface{}{"network": "lan-12345-my-network"},
+		}},
+		"2": {"id": "2", "name": "server2", "networks": []interface{}{
+			map[string]interface{}{"network": "wan-eu"},
+		}},
+	}
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		paths = append(paths, path)
+		switch path {
+		case "service/servers":
+			return []interface{}{
+				map[string]interface{}{"id": "1", "datacenter": "EU"},
+				map[string]interface{}{"id": "2", "datacenter": "EU"},
+				map[string]interface{}{"id": "3", "datacenter": nil},
+			}, nil
+		case "service/server/info":
+			return []interface{}{serversInfo[body.(listServersPostValues).ID]}, nil
+		case "service/network/subnet/delete", "service/network/delete":
+			return map[string]interface{}{}, nil
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	data := func(forceDetach bool) *schema.ResourceData {
+		return schema.TestResourceDataRaw(t, resourceNetwork().Schema, map[string]interface{}{
+			"name":          "my-network",
+			"full_name":     "lan-12345-my-network",
+			"datacenter_id": "EU",
+			"network_id":    456,
+			"force_detach":  forceDetach,
+			"subnet":        []interface{}{map[string]interface{}{"id": 789, "ip": "172.16.0.0", "bit": 23}},
+		})
+	}
+
+	diags := resourceNetworkDelete(context.Background(), data(false), &ProviderConfig{})
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, "cannot delete network lan-12345-my-network, it is attached to the following servers: "+
+			"server1. Remove the network from the servers network blocks or detach it in the Kamatera console, "+
+			"then delete the network", diags[0].Summary)
+	}
+	diags = resourceNetworkDelete(context.Background(), data(true), &ProviderConfig{})
+	if assert.Len(t, diags, 1) {
+		assert.Contains(t, diags[0].Summary, "force_detach is not supported")
+	}
+	// nothing is deleted while servers are attached
+	assert.NotContains(t, paths, "service/network/subnet/delete")
+	assert.NotContains(t, paths, "service/network/delete")
+
+	serversInfo["1"]["networks"] = []interface{}{map[string]interface{}{"network": "wan-eu"}}
+	paths = nil
+	assert.Len(t, resourceNetworkDelete(context.Background(), data(false), &ProviderConfig{}), 0)
+	assert.Equal(t, []string{
+		"service/servers", "service/server/info", "service/server/info",
+		"service/network/subnet/delete", "service/network/delete",
+	}, paths)
+}
+
+func TestNetworkResourceCustomizeDiff(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "123",
+		Attributes: map[string]string{
+			"id":            "123",
+			"name":          "my-network",
+			"full_name":     "lan-12345-my-network",
+			"datacenter_id": "EU",
+			"network_id":    "456",
+			"force_detach":  "false",
+			"subnet.#":      "0",
+		},
+	}
+	tests := []struct {
+		name                string
+		config              map[string]interface{}
+		expectedRequiresNew bool
+	}{
+		{"no change", map[string]interface{}{"name": "my-network", "datacenter_id": "EU"}, false},
+		{"rename", map[string]interface{}{"name": "my-network-2", "datacenter_id": "EU"}, true},
+		{"change datacenter", map[string]interface{}{"name": "my-network", "datacenter_id": "IL"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := resourceNetwork().Diff(context.Background(), state, terraform.NewResourceConfigRaw(tt.config), nil)
+			assert.NoError(t, err)
+			if tt.expectedRequiresNew {
+				assert.True(t, diff.RequiresNew(), "Expected diff to require replacement")
+				assert.True(t, diff.Attributes["full_name"].NewComputed, "Expected full_name to be unknown after replacement")
+			} else {
+				assert.True(t, diff == nil || !diff.RequiresNew(), "Expected diff to not require replacement")
+			}
+		})
+	}
+}
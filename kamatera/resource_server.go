@@ -2,12 +2,19 @@ package kamatera
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+	"log"
+	"net"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
 )
@@ -40,9 +47,10 @@ func resourceServer() *schema.Resource {
 			},
 			"datacenter_id": {
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
+				Computed:    true,
 				ForceNew:    true,
-				Description: "id attribute of datacenter data source.",
+				Description: "id attribute of datacenter data source. If not set, the provider default_datacenter_id is used.",
 				ValidateFunc: validation.All(
 					validation.StringLenBetween(2, 6),
 					validation.StringMatch(regexp.MustCompile(`^[A-Z0-9-]+$`), "must contain only uppercase letters, digits and dashes (-)"),
@@ -74,15 +82,45 @@ func resourceServer() *schema.Resource {
 				ValidateFunc: validation.IntAtLeast(256),
 			},
 			"disk_sizes_gb": {
-				Type:     schema.TypeList,
-				Elem:     &schema.Schema{Type: schema.TypeInt},
-				MinItems: 1,
-				MaxItems: 4,
-				Optional: true,
+				Type:          schema.TypeList,
+				Elem:          &schema.Schema{Type: schema.TypeInt, ValidateDiagFunc: validateServerOptionsDiskSizeGB},
+				MinItems:      1,
+				MaxItems:      4,
+				Optional:      true,
+				Computed:      true,
+				ConflictsWith: []string{"disk"},
 				Description: "List of disk sizes in GB, each item in the list will create a new disk in given " +
-					"size and attach it to the server.",
-				DefaultFunc: func() (interface{}, error) {
-					return []interface{}{10}, nil
+					"size and attach it to the server. Defaults to a single 10GB disk. When using disk blocks, " +
+					"this attribute contains the disk sizes ordered by the disk index.",
+			},
+			"disk": {
+				Type:          schema.TypeList,
+				Optional:      true,
+				MaxItems:      4,
+				ConflictsWith: []string{"disk_sizes_gb"},
+				Description: "Named disks, as an alternative to disk_sizes_gb. Each disk is identified by its name, so " +
+					"removing a disk removes exactly that disk and changing a disk size resizes only that disk. " +
+					"The first disk is the boot disk, new disks are attached after the existing disks.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ValidateFunc: validation.StringIsNotWhiteSpace,
+							Description:  "Unique name of the disk, used to identify the disk on changes.",
+						},
+						"size_gb": {
+							Type:             schema.TypeInt,
+							Required:         true,
+							ValidateDiagFunc: validateServerOptionsDiskSizeGB,
+							Description:      "The disk size in GB.",
+						},
+						"index": {
+							Type:        schema.TypeInt,
+							Computed:    true,
+							Description: "The index of the disk in the server, 0 is the boot disk.",
+						},
+					},
 				},
 			},
 			"billing_cycle": {
@@ -155,16 +193,43 @@ func resourceServer() *schema.Resource {
 				Description: "Set to true for managed support services.",
 			},
 			"password": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				Sensitive:   true,
-				Description: "The server root password.",
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				ConflictsWith: []string{"password_wo"},
+				Description:   "The server root password.",
+			},
+			"password_wo": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Sensitive:     true,
+				WriteOnly:     true,
+				ConflictsWith: []string{"password"},
+				Description: "The server root password, write-only so it is not stored in the plan or state. " +
+					"Requires Terraform 1.11 or later. Change password_wo_version to update the password.",
+			},
+			"password_wo_version": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				RequiredWith: []string{"password_wo"},
+				Description:  "Change this value to update the server root password from password_wo.",
 			},
 			"ssh_pubkey": {
-				Type:        schema.TypeString,
-				Optional:    true,
-				ForceNew:    true,
-				Description: "SSH public key to allow access to the server without a password.",
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ConflictsWith:    []string{"ssh_pubkeys"},
+				DiffSuppressFunc: serverSSHKeysDiffSuppressFunc,
+				Description:      "SSH public key to allow access to the server without a password.",
+			},
+			"ssh_pubkeys": {
+				Type:             schema.TypeList,
+				Elem:             &schema.Schema{Type: schema.TypeString},
+				Optional:         true,
+				ForceNew:         true,
+				ConflictsWith:    []string{"ssh_pubkey"},
+				DiffSuppressFunc: serverSSHKeysDiffSuppressFunc,
+				Description:      "List of SSH public keys to allow access to the server without a password.",
 			},
 			"generated_password": {
 				Type:        schema.TypeString,
@@ -175,17 +240,17 @@ func resourceServer() *schema.Resource {
 			"price_monthly_on": {
 				Type:        schema.TypeString,
 				Computed:    true,
-				Description: "The monthly price if server is turned on for the entire month.",
+				Description: "The monthly price if server is turned on for the entire month. Estimated in the plan when the server configuration changes.",
 			},
 			"price_hourly_on": {
 				Type:        schema.TypeString,
 				Computed:    true,
-				Description: "The hourly price if server is turned on for the entire hour.",
+				Description: "The hourly price if server is turned on for the entire hour. Estimated in the plan when the server configuration changes.",
 			},
 			"price_hourly_off": {
 				Type:        schema.TypeString,
 				Computed:    true,
-				Description: "The hourly price if server is turned off for the entire hour.",
+				Description: "The hourly price if server is turned off for the entire hour. Estimated in the plan when the server configuration changes.",
 			},
 			"attached_networks": {
 				Type: schema.TypeList,
@@ -219,9 +284,101 @@ func resourceServer() *schema.Resource {
 				Computed: true,
 			},
 			"startup_script": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				ForceNew:         true,
+				ConflictsWith:    []string{"startup_script_file"},
+				StateFunc:        startupScriptStateFunc,
+				DiffSuppressFunc: startupScriptDiffSuppressFunc,
+				Description: "Script to run when the server is created. Variables from startup_script_vars are " +
+					"substituted in the script. Only the SHA-256 digest of the script is stored in the state, so " +
+					"changes to the script show as a digest change.",
+			},
+			"startup_script_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"startup_script"},
+				Description: "Path of a file with the script to run when the server is created, as an alternative " +
+					"to startup_script. Variables from startup_script_vars are substituted in the script. " +
+					"Changing the file content replaces the server.",
+			},
+			"startup_script_vars": {
+				Type:     schema.TypeMap,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Optional: true,
+				Description: "Variables to substitute in the startup script, each ${name} in the script is replaced " +
+					"with the value of the variable with the same name, other ${...} expressions are left as is. " +
+					"Changing the variables replaces the server if it changes the startup script.",
+			},
+			"startup_script_sha256": {
 				Type:     schema.TypeString,
+				Computed: true,
+				Description: "SHA-256 digest of the startup script after substituting the variables, " +
+					"empty if the server has no startup script.",
+			},
+			"wait_for": {
+				Type:     schema.TypeList,
+				MaxItems: 1,
 				Optional: true,
-				ForceNew: true,
+				Description: "Wait after creating the server until it accepts connections on a TCP port, " +
+					"so that provisioners and dependent resources don't run before the server is ready.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"tcp_port": {
+							Type:         schema.TypeInt,
+							Required:     true,
+							ValidateFunc: validation.IsPortNumber,
+							Description:  "The TCP port to wait for, e.g. 22 for SSH.",
+						},
+						"timeout": {
+							Type:             schema.TypeString,
+							Optional:         true,
+							Default:          "10m",
+							ValidateDiagFunc: validateDuration,
+							Description:      "How long to wait for the port to accept connections, e.g. 30s or 10m.",
+						},
+						"address": {
+							Type:         schema.TypeString,
+							Optional:     true,
+							Default:      "public",
+							ValidateFunc: validation.StringInSlice([]string{"public", "private"}, false),
+							Description:  "public to connect to the first public IP or private to connect to the first private IP.",
+						},
+					},
+				},
+			},
+			"fail_on_startup_script_error": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Set to true to fail the server creation if the startup script exits with a non-zero " +
+					"exit code. The server is created and marked as tainted, so it will be recreated on the next apply. " +
+					"If the creation log doesn't include the startup script result, a warning is shown instead.",
+			},
+			"creation_log": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The log of the server creation command, it may include the startup script output.",
+			},
+			"startup_script_output": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Sensitive:   true,
+				Description: "The output of the startup script, if it is included in the creation log.",
+			},
+			"startup_script_exit_code": {
+				Type:     schema.TypeInt,
+				Computed: true,
+				Description: "The exit code of the startup script, if it is included in the creation log. " +
+					"-1 if the startup script result is not available.",
+			},
+			"allow_disk_removal": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+				Description: "Set to true to allow removing data disks from the server, " +
+					"the data on removed disks is lost.",
 			},
 			"allow_recreate": {
 				Type:        schema.TypeBool,
@@ -234,52 +391,164 @@ func resourceServer() *schema.Resource {
 }
 
 func resourceServerCustomizeDiff(ctx context.Context, d *schema.ResourceDiff, m interface{}) error {
+	if err := customizeDiffDefaultDatacenterId(d, m); err != nil {
+		return err
+	}
+	if err := resourceServerCustomizeDiffDisks(d); err != nil {
+		return err
+	}
+	if err := resourceServerCustomizeDiffDiskChanges(d); err != nil {
+		return err
+	}
 	err := loadServerOptions()
 	if err != nil {
 		return fmt.Errorf("failed to load server options: %w", err)
 	}
-	var errors []error
-	err = serverOptionsValidateDatacenter(d.Get("datacenter_id").(string))
-	if err != nil {
-		errors = append(errors, err)
+	var diskSizesGB []int
+	for _, diskSize := range d.Get("disk_sizes_gb").([]interface{}) {
+		diskSizesGB = append(diskSizesGB, diskSize.(int))
+	}
+	config := serverOptionsConfig{
+		datacenterId:          d.Get("datacenter_id").(string),
+		cpuType:               d.Get("cpu_type").(string),
+		cpuCores:              d.Get("cpu_cores").(int),
+		ramMB:                 d.Get("ram_mb").(int),
+		diskSizesGB:           diskSizesGB,
+		billingCycle:          d.Get("billing_cycle").(string),
+		monthlyTrafficPackage: d.Get("monthly_traffic_package").(string),
+		dailyBackup:           d.Get("daily_backup").(bool),
+		managed:               d.Get("managed").(bool),
 	}
-	err = serverOptionsValidateCpu(fmt.Sprintf("%v%v", d.Get("cpu_cores"), d.Get("cpu_type")))
+	if m != nil && d.NewValueKnown("image_id") && (d.Id() == "" || d.HasChange("image_id") || d.HasChange("datacenter_id")) {
+		// the image OS is used only to validate the datacenter availability, if it can't be found the datacenter
+		// availability is not checked and the server creation fails if the API rejects the image
+		imageOs, err := getImageOs(m.(*ProviderConfig), config.datacenterId, d.Get("image_id").(string))
+		if err != nil {
+			log.Printf("[WARN] failed to get the image OS, not validating the image datacenter availability: %s", err)
+		}
+		config.imageOs = imageOs
+	}
+	errors := serverOptionsValidateConfig(config)
+	if len(errors) > 0 {
+		return serverOptionsPathError(errors)
+	}
+	if err := resourceServerCustomizeDiffStartupScript(d); err != nil {
+		return err
+	}
+	return resourceServerCustomizeDiffPrice(d, config)
+}
+
+// resourceServerCustomizeDiffDisks sets disk_sizes_gb in the plan from the disk blocks, or to the default single
+// disk when creating a server without disks configuration.
+func resourceServerCustomizeDiffDisks(d *schema.ResourceDiff) error {
+	if rawConfig := d.GetRawConfig(); rawConfig.IsKnown() && !rawConfig.IsNull() {
+		if disks := rawConfig.GetAttr("disk"); !disks.IsNull() && !disks.IsWhollyKnown() {
+			return d.SetNewComputed("disk_sizes_gb")
+		}
+	}
+	if len(d.Get("disk").([]interface{})) == 0 {
+		if d.Id() == "" && len(d.Get("disk_sizes_gb").([]interface{})) == 0 {
+			return d.SetNew("disk_sizes_gb", []interface{}{10})
+		}
+		return nil
+	}
+	_, disks, err := getServerNamedDiskChange(d)
 	if err != nil {
-		errors = append(errors, err)
+		return err
+	}
+	return d.SetNew("disk_sizes_gb", namedDiskSizes(disks))
+}
+
+// resourceServerCustomizeDiffDiskChanges rejects destructive disk changes of an existing server: shrinking a disk
+// requires recreation of the server, the boot disk can't be removed and removing data disks must be allowed
+// explicitly with allow_disk_removal.
+func resourceServerCustomizeDiffDiskChanges(d *schema.ResourceDiff) error {
+	if d.Id() == "" || !d.HasChange("disk_sizes_gb") || !d.NewValueKnown("disk_sizes_gb") {
+		return nil
+	}
+	o, n := d.GetChange("disk_sizes_gb")
+	var op diskOperation
+	var err error
+	if len(d.Get("disk").([]interface{})) > 0 {
+		op, _, err = getServerNamedDiskChange(d)
+	} else {
+		op, err = calDiskChangeOperation(o, n)
 	}
-	err = serverOptionsValidateRamMB(d.Get("cpu_type").(string), d.Get("ram_mb").(int))
 	if err != nil {
-		errors = append(errors, err)
+		return err
 	}
-	for _, diskSize := range d.Get("disk_sizes_gb").([]interface{}) {
-		err = serverOptionsValidateDiskSizeGB(diskSize.(int))
-		if err != nil {
-			errors = append(errors, err)
+	if shrinks := diskShrinks(o.([]interface{}), op); len(shrinks) > 0 {
+		if d.Get("allow_recreate").(bool) {
+			return d.ForceNew("disk_sizes_gb")
 		}
+		return fmt.Errorf("disks can't be shrunk: %s, set allow_recreate to true to recreate the server",
+			strings.Join(shrinks, ", "))
 	}
-	if d.Get("billing_cycle").(string) == "monthly" {
-		err = serverOptionsValidateMonthlyTrafficPackage(d.Get("datacenter_id").(string), d.Get("monthly_traffic_package").(string))
-		if err != nil {
-			errors = append(errors, err)
+	for _, index := range op.remove {
+		if index == 0 {
+			return fmt.Errorf("the boot disk at index 0 can't be removed")
 		}
-	} else if d.Get("billing_cycle").(string) != "hourly" {
-		errors = append(errors, fmt.Errorf("billing cycle must be either 'hourly' or 'monthly', got '%s'", d.Get("billing_cycle").(string)))
 	}
-	if len(errors) > 0 {
-		var errorMessages []string
-		for _, e := range errors {
-			errorMessages = append(errorMessages, e.Error())
+	if len(op.remove) > 0 && !d.Get("allow_disk_removal").(bool) {
+		var indexes []string
+		for _, index := range op.remove {
+			indexes = append(indexes, strconv.Itoa(index))
 		}
-		return fmt.Errorf("invalid server configuration: %s", strings.Join(errorMessages, ", "))
-	} else {
-		return nil
+		return fmt.Errorf("removing disks at index %s deletes their data, set allow_disk_removal to true to allow it",
+			strings.Join(indexes, ", "))
 	}
+	return nil
+}
+
+// resourceServerCustomizeDiffPrice sets the estimated prices in the plan when creating a server or changing
+// its configuration. If the price can't be estimated the prices are known only after apply.
+func resourceServerCustomizeDiffPrice(d *schema.ResourceDiff, config serverOptionsConfig) error {
+	if d.Id() != "" {
+		hasChange := false
+		for _, key := range []string{
+			"datacenter_id", "cpu_type", "cpu_cores", "ram_mb", "disk_sizes_gb",
+			"billing_cycle", "monthly_traffic_package", "daily_backup", "managed",
+		} {
+			if d.HasChange(key) {
+				hasChange = true
+				break
+			}
+		}
+		if !hasChange {
+			return nil
+		}
+	}
+	price, _, err := serverOptionsEstimatePrice(config)
+	if err != nil {
+		log.Printf("[WARN] the server price can't be estimated, the prices are known only after apply: %s", err)
+	}
+	for key, value := range map[string]float64{
+		"price_monthly_on": price.monthlyOn,
+		"price_hourly_on":  price.hourlyOn,
+		"price_hourly_off": price.hourlyOff,
+	} {
+		if err != nil {
+			if e := d.SetNewComputed(key); e != nil {
+				return e
+			}
+		} else if e := d.SetNew(key, formatPrice(value)); e != nil {
+			return e
+		}
+	}
+	return nil
 }
 
 func resourceServerCreate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
 	provider := m.(*ProviderConfig)
 
 	password := d.Get("password").(string)
+	if password == "" {
+		passwordWo, diags := getServerPasswordWo(d)
+		if diags.HasError() {
+			return diags
+		}
+		password = passwordWo
+	}
 	if password == "" {
 		password = "__generate__"
 	}
@@ -316,11 +585,17 @@ func resourceServerCreate(ctx context.Context, d *schema.ResourceData, m interfa
 		}
 	}
 
+	startupScript, err := getServerStartupScript(d)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	d.Set("startup_script_sha256", startupScriptSha256(startupScript))
+
 	body := &createServerPostValues{
 		Name:             d.Get("name").(string),
 		Password:         password,
 		PasswordValidate: password,
-		SSHKey:           d.Get("ssh_pubkey").(string),
+		SSHKey:           getServerSSHKeys(d),
 		Datacenter:       d.Get("datacenter_id").(string),
 		Image:            d.Get("image_id").(string),
 		CPU:              fmt.Sprintf("%v%v", d.Get("cpu_cores"), d.Get("cpu_type")),
@@ -333,7 +608,7 @@ func resourceServerCreate(ctx context.Context, d *schema.ResourceData, m interfa
 		BillingCycle:     d.Get("billing_cycle").(string),
 		MonthlyPackage:   d.Get("monthly_traffic_package").(string),
 		PowerOn:          powerOn,
-		ScriptFile:       d.Get("startup_script").(string),
+		ScriptFile:       startupScript,
 	}
 	result, err := request(provider, "POST", "service/server", body)
 	if err != nil {
@@ -375,7 +650,143 @@ func resourceServerCreate(ctx context.Context, d *schema.ResourceData, m interfa
 		return diag.Errorf("invalid response from Kamatera API: failed to get created server name")
 	}
 	d.SetId(createdServerName)
-	return resourceServerRead(ctx, d, m)
+	d.Set("creation_log", createLog.(string))
+	startupScriptOutput, startupScriptExitCode := parseStartupScriptResult(createLog.(string))
+	d.Set("startup_script_output", startupScriptOutput)
+	d.Set("startup_script_exit_code", startupScriptExitCode)
+
+	if len(d.Get("disk").([]interface{})) > 0 {
+		_, disks, err := getServerNamedDiskChange(d)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+		d.Set("disk", disks)
+	}
+
+	diags = resourceServerRead(ctx, d, m)
+	if diags.HasError() {
+		return diags
+	}
+	if d.Get("fail_on_startup_script_error").(bool) && startupScript != "" {
+		diags = append(diags, getStartupScriptResultDiags(startupScriptOutput, startupScriptExitCode)...)
+	}
+	if !diags.HasError() {
+		diags = append(diags, resourceServerWaitFor(ctx, d)...)
+	}
+	return diags
+}
+
+// waitForServerPortInterval is the interval between connection attempts when waiting for the server port.
+var waitForServerPortInterval = 5 * time.Second
+
+// resourceServerWaitFor waits for the server to accept connections according to the wait_for block.
+func resourceServerWaitFor(ctx context.Context, d *schema.ResourceData) diag.Diagnostics {
+	waitFor := d.Get("wait_for").([]interface{})
+	if len(waitFor) == 0 || waitFor[0] == nil {
+		return nil
+	}
+	config := waitFor[0].(map[string]interface{})
+	port := config["tcp_port"].(int)
+	timeout, err := time.ParseDuration(config["timeout"].(string))
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	ips := d.Get(fmt.Sprintf("%s_ips", config["address"].(string))).([]interface{})
+	if len(ips) == 0 {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("server has no %s IP to wait for", config["address"].(string)),
+			AttributePath: cty.GetAttrPath("wait_for").IndexInt(0).GetAttr("address"),
+		}}
+	}
+	address := net.JoinHostPort(ips[0].(string), strconv.Itoa(port))
+	if err := waitForServerPort(ctx, address, timeout); err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  "server is not ready",
+			Detail: fmt.Sprintf("%s, the server was created but will be replaced on the next apply. "+
+				"Increase wait_for timeout if the server takes longer to start.", err),
+			AttributePath: cty.GetAttrPath("wait_for").IndexInt(0).GetAttr("tcp_port"),
+		}}
+	}
+	return nil
+}
+
+// waitForServerPort tries to connect to the address until a connection succeeds or the timeout expires.
+func waitForServerPort(ctx context.Context, address string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	var dialer net.Dialer
+	for {
+		dialCtx, cancel := context.WithTimeout(ctx, waitForServerPortInterval)
+		conn, err := dialer.DialContext(dialCtx, "tcp", address)
+		cancel()
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().Add(waitForServerPortInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s to accept connections: %w", timeout, address, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitForServerPortInterval):
+		}
+	}
+}
+
+func validateDuration(value interface{}, path cty.Path) diag.Diagnostics {
+	if _, err := time.ParseDuration(value.(string)); err != nil {
+		return diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       fmt.Sprintf("invalid duration: %s", value.(string)),
+			Detail:        "expected a duration such as 30s or 10m",
+			AttributePath: path,
+		}}
+	}
+	return nil
+}
+
+// parseStartupScriptResult returns the startup script output and exit code from the server creation log,
+// the exit code is -1 if the creation log doesn't include the startup script result.
+func parseStartupScriptResult(createLog string) (string, int) {
+	var outputLines []string
+	inOutput := false
+	for _, line := range strings.Split(createLog, "\n") {
+		if strings.HasPrefix(line, "Startup script exit code: ") {
+			exitCode, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "Startup script exit code: ")))
+			if err != nil {
+				return strings.Join(outputLines, "\n"), -1
+			}
+			return strings.Join(outputLines, "\n"), exitCode
+		} else if inOutput {
+			outputLines = append(outputLines, line)
+		} else if strings.TrimSpace(line) == "Startup script output:" {
+			inOutput = true
+		}
+	}
+	return strings.Join(outputLines, "\n"), -1
+}
+
+// getStartupScriptResultDiags returns an error if the startup script failed, or a warning if the creation log doesn't
+// include the startup script result, so that fail_on_startup_script_error doesn't silently pass.
+func getStartupScriptResultDiags(output string, exitCode int) diag.Diagnostics {
+	if exitCode < 0 {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  "startup script result is not available",
+			Detail: "the server creation log doesn't include the startup script exit code, so " +
+				"fail_on_startup_script_error can't check if the startup script failed, see the creation_log attribute",
+		}}
+	}
+	if exitCode > 0 {
+		return diag.Diagnostics{{
+			Severity: diag.Error,
+			Summary:  fmt.Sprintf("startup script failed with exit code %d", exitCode),
+			Detail:   output,
+		}}
+	}
+	return nil
 }
 
 func resourceServerRead(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
@@ -413,19 +824,21 @@ func resourceServerRead(ctx context.Context, d *schema.ResourceData, m interface
 	}
 
 	{
-		diskSizes := server["diskSizes"].([]interface{})
-		var diskSizesString []int
-		for _, v := range diskSizes {
-			var intv int
-			switch v.(type) {
-			case int:
-				intv = v.(int)
-			case float64:
-				intv = int(v.(float64))
+		diskSizesString := getServerDiskSizes(server)
+		d.Set("disk_sizes_gb", diskSizesString)
+
+		if configuredDisks := d.Get("disk").([]interface{}); len(configuredDisks) > 0 {
+			var disks []interface{}
+			for _, v := range configuredDisks {
+				disk := v.(map[string]interface{})
+				// disks which were removed outside of Terraform are removed from the state
+				if index := disk["index"].(int); index < len(diskSizesString) {
+					disk["size_gb"] = diskSizesString[index]
+					disks = append(disks, disk)
+				}
 			}
-			diskSizesString = append(diskSizesString, intv)
+			d.Set("disk", disks)
 		}
-		d.Set("disk_sizes_gb", diskSizesString)
 	}
 
 	d.Set("power_on", server["power"].(string) == "on")
@@ -449,13 +862,22 @@ func resourceServerRead(ctx context.Context, d *schema.ResourceData, m interface
 	d.Set("price_hourly_on", server["priceHourlyOn"].(string))
 	d.Set("price_hourly_off", server["priceHourlyOff"].(string))
 
-	networks := server["networks"].([]interface{})
-	var publicIPs []string
-	var privateIPs []string
 	var attachedNetworks []interface{}
-	for _, network := range networks {
-		network := network.(map[string]interface{})
+	for _, network := range server["networks"].([]interface{}) {
 		attachedNetworks = append(attachedNetworks, network)
+	}
+	publicIPs, privateIPs := getServerIPs(server)
+	d.Set("public_ips", publicIPs)
+	d.Set("private_ips", privateIPs)
+	d.Set("attached_networks", attachedNetworks)
+
+	return
+}
+
+// getServerIPs returns the IPs of the server public (wan) networks and private networks.
+func getServerIPs(server map[string]interface{}) (publicIPs []string, privateIPs []string) {
+	for _, network := range server["networks"].([]interface{}) {
+		network := network.(map[string]interface{})
 		if strings.Index(network["network"].(string), "wan-") == 0 {
 			for _, ip := range network["ips"].([]interface{}) {
 				publicIPs = append(publicIPs, ip.(string))
@@ -466,14 +888,39 @@ func resourceServerRead(ctx context.Context, d *schema.ResourceData, m interface
 			}
 		}
 	}
-	d.Set("public_ips", publicIPs)
-	d.Set("private_ips", privateIPs)
-	d.Set("attached_networks", attachedNetworks)
+	return publicIPs, privateIPs
+}
 
-	return
+// serverUpdateAttributes are the attributes which are changed by the server update steps.
+var serverUpdateAttributes = []string{
+	"cpu_type", "cpu_cores", "ram_mb", "billing_cycle", "monthly_traffic_package", "daily_backup", "managed",
+	"disk_sizes_gb", "disk", "price_monthly_on", "price_hourly_on", "price_hourly_off",
+	"password", "password_wo_version", "name", "power_on",
 }
 
 func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interface{}) (diags diag.Diagnostics) {
+	// if a step fails, the attributes of the steps which were not applied keep their previous values, otherwise the
+	// planned values are stored in the state and the next apply doesn't retry the changes
+	pending := map[string]bool{}
+	for _, key := range serverUpdateAttributes {
+		if d.HasChange(key) {
+			pending[key] = true
+		}
+	}
+	applied := func(keys ...string) {
+		for _, key := range keys {
+			delete(pending, key)
+		}
+	}
+	defer func() {
+		if diags.HasError() {
+			for key := range pending {
+				o, _ := d.GetChange(key)
+				d.Set(key, o)
+			}
+		}
+	}()
+
 	newCPU := ""
 	{
 		var newCPUType interface{}
@@ -513,7 +960,7 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 		return diag.Errorf("changing server networks requires recreation, set allow_recreate to true to allow this change")
 	}
 
-	if d.HasChange("ssh_pubkey") && !d.Get("allow_recreate").(bool) {
+	if d.HasChanges("ssh_pubkey", "ssh_pubkeys") && !d.Get("allow_recreate").(bool) {
 		return diag.Errorf("changing server ssh_pubkey requires recreation, set allow_recreate to true to allow this change")
 	}
 
@@ -558,7 +1005,7 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 	}
 
 	provider := m.(*ProviderConfig)
-	if err := serverConfigure(
+	configured, err := serverConfigure(
 		provider,
 		d.Get("internal_server_id").(string),
 		newCPU,
@@ -567,11 +1014,34 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 		oldBillingCycle, newBillingCycle,
 		newDailyBackup,
 		newManaged,
-	); err != nil {
+	)
+	applied(configured...)
+	if err != nil {
 		return diag.FromErr(err)
 	}
 
-	if d.HasChange("disk_sizes_gb") {
+	if len(d.Get("disk").([]interface{})) > 0 {
+		if d.HasChanges("disk", "disk_sizes_gb") {
+			op, disks, err := getServerNamedDiskChange(d)
+			if err != nil {
+				return diag.FromErr(err)
+			}
+
+			oldDisks := getServerOldNamedDisks(d)
+			done, diskSizes, err := changeDisks(provider, d.Get("internal_server_id").(string), op)
+			if diskSizes != nil {
+				d.Set("disk_sizes_gb", diskSizes)
+			}
+			if err != nil {
+				d.Set("disk", applyNamedDiskOperation(oldDisks, disks, done))
+				if diskSizes != nil {
+					applied("disk_sizes_gb", "disk")
+				}
+				return diag.FromErr(err)
+			}
+			d.Set("disk", disks)
+		}
+	} else if d.HasChange("disk_sizes_gb") {
 		o, n := d.GetChange("disk_sizes_gb")
 
 		op, err := calDiskChangeOperation(o, n)
@@ -579,22 +1049,39 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 			return diag.FromErr(err)
 		}
 
-		err = changeDisks(provider, d.Get("internal_server_id").(string), op)
+		_, diskSizes, err := changeDisks(provider, d.Get("internal_server_id").(string), op)
+		if diskSizes != nil {
+			d.Set("disk_sizes_gb", diskSizes)
+			applied("disk_sizes_gb")
+		}
 		if err != nil {
 			return diag.FromErr(err)
 		}
 	}
+	applied("disk_sizes_gb", "disk", "price_monthly_on", "price_hourly_on", "price_hourly_off")
 
 	if d.HasChange("password") {
-		o, n := d.GetChange("password")
+		_, n := d.GetChange("password")
 
 		err := serverChangePassword(provider, d.Get("internal_server_id").(string), n.(string))
 		if err != nil {
-			d.Set("password", o)
 			return diag.FromErr(err)
 		}
+		applied("password")
+	}
 
-		d.Set("password", n)
+	if d.HasChange("password_wo_version") {
+		password, diags := getServerPasswordWo(d)
+		if diags.HasError() {
+			return diags
+		}
+		if password == "" {
+			return diag.Errorf("password_wo must be set when changing password_wo_version")
+		}
+		if err := serverChangePassword(provider, d.Get("internal_server_id").(string), password); err != nil {
+			return diag.FromErr(err)
+		}
+		applied("password_wo_version")
 	}
 
 	if d.HasChange("name") {
@@ -603,6 +1090,7 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 			return diag.FromErr(err)
 		}
 		d.Set("name", n)
+		applied("name")
 	}
 
 	if d.HasChange("power_on") {
@@ -616,10 +1104,76 @@ func resourceServerUpdate(ctx context.Context, d *schema.ResourceData, m interfa
 			}
 		}
 	}
+	applied("power_on")
 
 	return resourceServerRead(ctx, d, m)
 }
 
+// getServerPasswordWo returns the write-only password from the configuration, which is not available from d.Get.
+func getServerPasswordWo(d *schema.ResourceData) (string, diag.Diagnostics) {
+	rawConfig := d.GetRawConfig()
+	if rawConfig.IsNull() || !rawConfig.IsKnown() {
+		return "", nil
+	}
+	value := rawConfig.GetAttr("password_wo")
+	if value.IsNull() {
+		return "", nil
+	}
+	if !value.IsKnown() {
+		return "", diag.Diagnostics{{
+			Severity:      diag.Error,
+			Summary:       "password_wo value is not known",
+			AttributePath: cty.GetAttrPath("password_wo"),
+		}}
+	}
+	return value.AsString(), nil
+}
+
+// getServerSSHKeys returns the server SSH public keys in authorized_keys format, one key per line.
+func getServerSSHKeys(d *schema.ResourceData) string {
+	if sshPubkey := d.Get("ssh_pubkey").(string); sshPubkey != "" {
+		return sshPubkey
+	}
+	var sshPubkeys []string
+	for _, sshPubkey := range d.Get("ssh_pubkeys").([]interface{}) {
+		if sshPubkey != nil && strings.TrimSpace(sshPubkey.(string)) != "" {
+			sshPubkeys = append(sshPubkeys, strings.TrimSpace(sshPubkey.(string)))
+		}
+	}
+	return strings.Join(sshPubkeys, "\n")
+}
+
+// normalizeServerSSHKeys returns the sorted unique SSH public keys from the ssh_pubkey and ssh_pubkeys values.
+func normalizeServerSSHKeys(sshPubkey interface{}, sshPubkeys interface{}) []string {
+	keys := map[string]bool{}
+	if sshPubkey, ok := sshPubkey.(string); ok && strings.TrimSpace(sshPubkey) != "" {
+		keys[strings.TrimSpace(sshPubkey)] = true
+	}
+	list, _ := sshPubkeys.([]interface{})
+	for _, key := range list {
+		if key, ok := key.(string); ok && strings.TrimSpace(key) != "" {
+			keys[strings.TrimSpace(key)] = true
+		}
+	}
+	var res []string
+	for key := range keys {
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// serverSSHKeysDiffSuppressFunc suppresses the ssh_pubkey and ssh_pubkeys diff when the same keys are moved between
+// the two attributes, so that moving a key doesn't recreate the server.
+func serverSSHKeysDiffSuppressFunc(k, old, new string, d *schema.ResourceData) bool {
+	oldSSHPubkey, newSSHPubkey := d.GetChange("ssh_pubkey")
+	oldSSHPubkeys, newSSHPubkeys := d.GetChange("ssh_pubkeys")
+	return reflect.DeepEqual(
+		normalizeServerSSHKeys(oldSSHPubkey, oldSSHPubkeys),
+		normalizeServerSSHKeys(newSSHPubkey, newSSHPubkeys),
+	)
+}
+
 func resourceServerDelete(ctx context.Context, d *schema.ResourceData, m interface{}) diag.Diagnostics {
 	provider := m.(*ProviderConfig)
 	err := changeServerPower(provider, d.Get("internal_server_id").(string), "terminate")
@@ -631,38 +1185,45 @@ func resourceServerDelete(ctx context.Context, d *schema.ResourceData, m interfa
 
 func resourceServerImport(ctx context.Context, d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
 	d.Set("internal_server_id", d.Id())
+	// the creation log is not available for imported servers
+	d.Set("startup_script_exit_code", -1)
 	diags := resourceServerRead(ctx, d, m)
 	if diags.HasError() {
 		var errorMessages []string
 		for i := range diags {
 			errorMessages = append(errorMessages, diags[i].Summary)
 		}
-		return nil, fmt.Errorf(strings.Join(errorMessages, ", "))
+		return nil, errors.New(strings.Join(errorMessages, ", "))
 	}
 	return []*schema.ResourceData{d}, nil
 }
 
+// serverConfigureStep is a single server configure call and the attributes it changes.
+type serverConfigureStep struct {
+	attributes []string
+	values     configureServerPostValues
+}
+
+// serverConfigure applies the server configuration changes, it returns the attributes which were changed
+// successfully, also when it fails.
 func serverConfigure(
 	provider *ProviderConfig, internalServerId string, newCpu string, newRam int,
 	oldTrafficPackage string, newTrafficPackage string, oldBillingCycle string, newBillingCycle string,
 	newDailyBackup string, newManaged string,
-) error {
+) ([]string, error) {
+	var steps []serverConfigureStep
 	if newCpu != "" {
-		if e := postServerConfigure(
-			provider,
-			configureServerPostValues{ID: internalServerId, CPU: newCpu},
-		); e != nil {
-			return e
-		}
+		steps = append(steps, serverConfigureStep{
+			attributes: []string{"cpu_type", "cpu_cores"},
+			values:     configureServerPostValues{CPU: newCpu},
+		})
 	}
 
 	if newRam != 0 {
-		if e := postServerConfigure(
-			provider,
-			configureServerPostValues{ID: internalServerId, RAM: newRam},
-		); e != nil {
-			return e
-		}
+		steps = append(steps, serverConfigureStep{
+			attributes: []string{"ram_mb"},
+			values:     configureServerPostValues{RAM: newRam},
+		})
 	}
 
 	if newTrafficPackage != "" || newBillingCycle != "" {
@@ -674,33 +1235,136 @@ func serverConfigure(
 		if newTrafficPackage != "" {
 			trafficPackage = newTrafficPackage
 		}
-		if e := postServerConfigure(
-			provider,
-			configureServerPostValues{ID: internalServerId, MonthlyPackage: trafficPackage, BillingCycle: billingCycle},
-		); e != nil {
-			return e
-		}
+		steps = append(steps, serverConfigureStep{
+			attributes: []string{"billing_cycle", "monthly_traffic_package"},
+			values:     configureServerPostValues{MonthlyPackage: trafficPackage, BillingCycle: billingCycle},
+		})
 	}
 
 	if newDailyBackup != "" {
-		if e := postServerConfigure(
-			provider,
-			configureServerPostValues{ID: internalServerId, DailyBackup: newDailyBackup},
-		); e != nil {
-			return e
-		}
+		steps = append(steps, serverConfigureStep{
+			attributes: []string{"daily_backup"},
+			values:     configureServerPostValues{DailyBackup: newDailyBackup},
+		})
 	}
 
 	if newManaged != "" {
-		if e := postServerConfigure(
-			provider,
-			configureServerPostValues{ID: internalServerId, Managed: newManaged},
-		); e != nil {
-			return e
+		steps = append(steps, serverConfigureStep{
+			attributes: []string{"managed"},
+			values:     configureServerPostValues{Managed: newManaged},
+		})
+	}
+
+	return serverConfigureSteps(provider, internalServerId, steps)
+}
+
+// serverConfigureSteps sends all the configure steps in a single configure call. If the API rejects the combined
+// call, for example because it doesn't support the combination, the steps are applied one at a time in order. If the
+// combined call fails otherwise it may be partially applied, so the server is read again and only the steps which
+// were not applied are retried. It returns the attributes of the applied steps.
+func serverConfigureSteps(provider *ProviderConfig, internalServerId string, steps []serverConfigureStep) ([]string, error) {
+	var applied []string
+	if len(steps) > 1 {
+		combined := configureServerPostValues{ID: internalServerId}
+		var attributes []string
+		for _, step := range steps {
+			if step.values.CPU != "" {
+				combined.CPU = step.values.CPU
+			}
+			if step.values.RAM != 0 {
+				combined.RAM = step.values.RAM
+			}
+			if step.values.DailyBackup != "" {
+				combined.DailyBackup = step.values.DailyBackup
+			}
+			if step.values.Managed != "" {
+				combined.Managed = step.values.Managed
+			}
+			if step.values.BillingCycle != "" {
+				combined.BillingCycle = step.values.BillingCycle
+			}
+			if step.values.MonthlyPackage != "" {
+				combined.MonthlyPackage = step.values.MonthlyPackage
+			}
+			attributes = append(attributes, step.attributes...)
+		}
+		err := postServerConfigure(provider, combined)
+		if err == nil || !isRejectedRequest(err) {
+			// the combined call may apply only some of the changes, the server info shows which were applied
+			server, infoErr := getServerInfo(provider, internalServerId)
+			if infoErr != nil {
+				if err == nil {
+					return nil, fmt.Errorf("failed to verify the server configuration: %w", infoErr)
+				}
+				return nil, fmt.Errorf("failed to configure server: %w", err)
+			}
+			var remaining []serverConfigureStep
+			for _, step := range steps {
+				if serverConfigureStepApplied(server, step.values) {
+					applied = append(applied, step.attributes...)
+				} else {
+					remaining = append(remaining, step)
+				}
+			}
+			if len(remaining) == 0 {
+				return applied, nil
+			}
+			steps = remaining
+			if err == nil {
+				err = fmt.Errorf("server configuration doesn't match after the call")
+			}
 		}
+		log.Printf("[WARN] failed to configure server in a single call, configuring one change at a time: %s", err)
 	}
 
-	return nil
+	for _, step := range steps {
+		step.values.ID = internalServerId
+		if err := postServerConfigure(provider, step.values); err != nil {
+			return applied, fmt.Errorf("failed to change %s: %w", strings.Join(step.attributes, ", "), err)
+		}
+		applied = append(applied, step.attributes...)
+	}
+	return applied, nil
+}
+
+// serverConfigureStepApplied returns true if the server info has all the values of the configure step.
+func serverConfigureStepApplied(server map[string]interface{}, values configureServerPostValues) bool {
+	if values.CPU != "" {
+		cpu, _ := server["cpu"].(string)
+		if cpu == "" || cpu[len(cpu)-1:] != values.CPU[len(values.CPU)-1:] {
+			return false
+		}
+		cores, err := strconv.ParseInt(cpu[:len(cpu)-1], 16, 32)
+		if err != nil || fmt.Sprint(cores) != values.CPU[:len(values.CPU)-1] {
+			return false
+		}
+	}
+	if values.RAM != 0 {
+		if ram, _ := server["ram"].(float64); int(ram) != values.RAM {
+			return false
+		}
+	}
+	if values.BillingCycle != "" {
+		if billing, _ := server["billing"].(string); billing != values.BillingCycle {
+			return false
+		}
+	}
+	if values.MonthlyPackage != "" {
+		if traffic, _ := server["traffic"].(string); traffic != values.MonthlyPackage {
+			return false
+		}
+	}
+	if values.DailyBackup != "" {
+		if backup, _ := server["backup"].(string); (backup == "1") != (values.DailyBackup == "yes") {
+			return false
+		}
+	}
+	if values.Managed != "" {
+		if managed, _ := server["managed"].(string); (managed == "1") != (values.Managed == "yes") {
+			return false
+		}
+	}
+	return true
 }
 
 func changeServerPower(provider *ProviderConfig, internalServerID string, operation string) error {
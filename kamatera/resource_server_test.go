@@ -1,10 +1,20 @@
 package kamatera
 
 import (
+	"context"
 	"fmt"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-cty/cty/msgpack"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/stretchr/testify/assert"
+	"net"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestResourceServerSchemaValidation(t *testing.T) {
@@ -44,7 +54,7 @@ func TestResourceServerSchemaValidation(t *testing.T) {
 		{"datacenter_id", "US-NY2", []string{}},
 
 		// cpu type
-		{"cpu_type", "C", []string{"expected cpu_type to be one of [A B T D], got C"}},
+		{"cpu_type", "C", []string{`expected cpu_type to be one of ["A" "B" "T" "D"], got C`}},
 		{"cpu_type", "A", []string{}},
 
 		// cpu cores
@@ -56,7 +66,7 @@ func TestResourceServerSchemaValidation(t *testing.T) {
 		{"ram_mb", 1024, []string{}},
 
 		// billing cycle
-		{"billing_cycle", "invalid", []string{"expected billing_cycle to be one of [hourly monthly], got invalid"}},
+		{"billing_cycle", "invalid", []string{`expected billing_cycle to be one of ["hourly" "monthly"], got invalid`}},
 		{"billing_cycle", "hourly", []string{}},
 		{"billing_cycle", "monthly", []string{}},
 	} {
@@ -78,3 +88,416 @@ func TestResourceServerSchemaValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceServerSSHKeys(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	d := schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{
+		"ssh_pubkeys": []interface{}{"ssh-rsa AAAA1 user1", " ssh-ed25519 AAAA2 user2\n", ""},
+	})
+	assert.Equal(t, "ssh-rsa AAAA1 user1\nssh-ed25519 AAAA2 user2", getServerSSHKeys(d))
+
+	d = schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{
+		"ssh_pubkey": "ssh-rsa AAAA1 user1",
+	})
+	assert.Equal(t, "ssh-rsa AAAA1 user1", getServerSSHKeys(d))
+
+	// the keys can only be set when creating the server
+	state := &terraform.InstanceState{ID: "my-server", Attributes: map[string]string{
+		"id":              "my-server",
+		"name":            "my-server",
+		"datacenter_id":   "EU",
+		"image_id":        "EU:ubuntu",
+		"cpu_type":        "B",
+		"cpu_cores":       "2",
+		"ram_mb":          "2048",
+		"disk_sizes_gb.#": "1",
+		"disk_sizes_gb.0": "20",
+		"billing_cycle":   "hourly",
+		"power_on":        "true",
+		"ssh_pubkeys.#":   "1",
+		"ssh_pubkeys.0":   "ssh-rsa AAAA1 user1",
+	}}
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"datacenter_id": "EU",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20},
+		"ssh_pubkeys":   []interface{}{"ssh-rsa AAAA1 user1", "ssh-ed25519 AAAA2 user2"},
+	}
+	diff, err := resourceServer().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.True(t, diff.RequiresNew())
+
+	// moving the same key between ssh_pubkeys and ssh_pubkey doesn't recreate the server
+	delete(config, "ssh_pubkeys")
+	config["ssh_pubkey"] = "ssh-rsa AAAA1 user1\n"
+	diff, err = resourceServer().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.False(t, diff.RequiresNew())
+	for k := range diff.Attributes {
+		assert.NotContains(t, k, "ssh_pubkey")
+	}
+
+	state.Attributes["ssh_pubkey"] = "ssh-rsa AAAA1 user1"
+	delete(state.Attributes, "ssh_pubkeys.#")
+	delete(state.Attributes, "ssh_pubkeys.0")
+	delete(config, "ssh_pubkey")
+	config["ssh_pubkeys"] = []interface{}{"ssh-rsa AAAA1 user1"}
+	diff, err = resourceServer().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.False(t, diff.RequiresNew())
+	for k := range diff.Attributes {
+		assert.NotContains(t, k, "ssh_pubkey")
+	}
+
+	// a different key recreates the server
+	config["ssh_pubkeys"] = []interface{}{"ssh-rsa AAAA3 user3"}
+	diff, err = resourceServer().Diff(context.Background(), state, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.True(t, diff.RequiresNew())
+}
+
+func TestResourceServerPasswordWo(t *testing.T) {
+	assert.NoError(t, resourceServer().InternalValidate(nil, true))
+
+	rawConfig := func(passwordWo cty.Value) cty.Value {
+		attrs := map[string]cty.Value{}
+		for name, attrType := range resourceServer().CoreConfigSchema().ImpliedType().AttributeTypes() {
+			attrs[name] = cty.NullVal(attrType)
+		}
+		attrs["password_wo"] = passwordWo
+		return cty.ObjectVal(attrs)
+	}
+
+	state := &terraform.InstanceState{ID: "my-server", RawConfig: rawConfig(cty.StringVal("secret-password"))}
+	password, diags := getServerPasswordWo(resourceServer().Data(state))
+	assert.False(t, diags.HasError())
+	assert.Equal(t, "secret-password", password)
+
+	state.RawConfig = rawConfig(cty.NullVal(cty.String))
+	password, diags = getServerPasswordWo(resourceServer().Data(state))
+	assert.False(t, diags.HasError())
+	assert.Equal(t, "", password)
+
+	state.RawConfig = rawConfig(cty.UnknownVal(cty.String))
+	_, diags = getServerPasswordWo(resourceServer().Data(state))
+	assert.True(t, diags.HasError())
+}
+
+func TestParseStartupScriptResult(t *testing.T) {
+	output, exitCode := parseStartupScriptResult("Name: my-server\nStartup script output:\ninstalling\nfailed\nStartup script exit code: 2\nDone")
+	assert.Equal(t, "installing\nfailed", output)
+	assert.Equal(t, 2, exitCode)
+
+	output, exitCode = parseStartupScriptResult("Name: my-server\nStartup script output:\nStartup script exit code: 0")
+	assert.Equal(t, "", output)
+	assert.Equal(t, 0, exitCode)
+
+	output, exitCode = parseStartupScriptResult("Name: my-server\nDone")
+	assert.Equal(t, "", output)
+	assert.Equal(t, -1, exitCode)
+
+	assert.Len(t, getStartupScriptResultDiags("", 0), 0)
+	diags := getStartupScriptResultDiags("installing\nfailed", 2)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, diag.Error, diags[0].Severity)
+		assert.Equal(t, "startup script failed with exit code 2", diags[0].Summary)
+		assert.Equal(t, "installing\nfailed", diags[0].Detail)
+	}
+	// the result is missing from the creation log
+	diags = getStartupScriptResultDiags("", -1)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, diag.Warning, diags[0].Severity)
+		assert.Equal(t, "startup script result is not available", diags[0].Summary)
+	}
+}
+
+func TestWaitForServerPort(t *testing.T) {
+	prevInterval := waitForServerPortInterval
+	waitForServerPortInterval = 10 * time.Millisecond
+	defer func() {
+		waitForServerPortInterval = prevInterval
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	address := listener.Addr().String()
+	assert.NoError(t, waitForServerPort(context.Background(), address, time.Second))
+
+	// the port stops accepting connections once the listener is closed
+	listener.Close()
+	err = waitForServerPort(context.Background(), address, 50*time.Millisecond)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), fmt.Sprintf("timed out after 50ms waiting for %s to accept connections", address))
+	}
+
+	// the port starts accepting connections while waiting
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		listener, err := net.Listen("tcp", address)
+		if err == nil {
+			defer listener.Close()
+			time.Sleep(time.Second)
+		}
+	}()
+	assert.NoError(t, waitForServerPort(context.Background(), address, time.Second))
+}
+
+func TestResourceServerWaitFor(t *testing.T) {
+	prevInterval := waitForServerPortInterval
+	waitForServerPortInterval = 10 * time.Millisecond
+	defer func() {
+		waitForServerPortInterval = prevInterval
+	}()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	d := schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{
+		"wait_for": []interface{}{map[string]interface{}{"tcp_port": port, "timeout": "1s", "address": "private"}},
+	})
+	d.Set("private_ips", []string{"127.0.0.1"})
+	assert.False(t, resourceServerWaitFor(context.Background(), d).HasError())
+
+	d.Set("private_ips", []string{})
+	diags := resourceServerWaitFor(context.Background(), d)
+	if assert.True(t, diags.HasError()) {
+		assert.Equal(t, "server has no private IP to wait for", diags[0].Summary)
+	}
+
+	d = schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{})
+	assert.Len(t, resourceServerWaitFor(context.Background(), d), 0)
+
+	assert.True(t, validateDuration("10x", cty.GetAttrPath("timeout")).HasError())
+	assert.False(t, validateDuration("10m", cty.GetAttrPath("timeout")).HasError())
+}
+
+func TestServerConfigure(t *testing.T) {
+	skipWaiting = true
+	var bodies []configureServerPostValues
+	failingBodies := map[int]error{}
+	var serverInfo map[string]interface{}
+	commandIds := []interface{}{"1", "2"}
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		if path == "service/server/info" {
+			if serverInfo == nil {
+				return nil, fmt.Errorf("info failed")
+			}
+			return []interface{}{serverInfo}, nil
+		}
+		assert.Equal(t, "server/configure", path)
+		bodies = append(bodies, body.(configureServerPostValues))
+		if err := failingBodies[len(bodies)]; err != nil {
+			return nil, err
+		}
+		return commandIds, nil
+	}
+	defer func() {
+		skipWaiting = false
+		mockableRequest = prevRequest
+	}()
+	rejectedErr := &apiError{statusCode: 400, result: "not supported"}
+
+	// the combined call is verified against the server info
+	serverInfo = map[string]interface{}{"cpu": "4B", "ram": 4096.0, "backup": "1", "managed": "0"}
+	applied, err := serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu_type", "cpu_cores", "ram_mb", "daily_backup"}, applied)
+	assert.Equal(t, []configureServerPostValues{{ID: "1", CPU: "4B", RAM: 4096, DailyBackup: "yes"}}, bodies)
+
+	// changes which the combined call didn't apply are applied one at a time
+	bodies = nil
+	serverInfo = map[string]interface{}{"cpu": "4B", "ram": 2048.0, "backup": "1", "managed": "0"}
+	applied, err = serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu_type", "cpu_cores", "daily_backup", "ram_mb"}, applied)
+	assert.Equal(t, []configureServerPostValues{
+		{ID: "1", CPU: "4B", RAM: 4096, DailyBackup: "yes"},
+		{ID: "1", RAM: 4096},
+	}, bodies)
+
+	// the combined call fails if it can't be verified
+	bodies = nil
+	serverInfo = nil
+	applied, err = serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.EqualError(t, err, "failed to verify the server configuration: info failed")
+	assert.Len(t, applied, 0)
+	assert.Len(t, bodies, 1)
+
+	// all the commands must be valid
+	bodies = nil
+	commandIds = []interface{}{"1", 2.0}
+	_, err = serverConfigure(nil, "1", "", 0, "", "", "", "", "yes", "")
+	assert.EqualError(t, err, "failed to change daily_backup: invalid response from Kamatera API: [1 2]")
+	commandIds = []interface{}{"1", "2"}
+
+	// a single change is sent as is
+	bodies = nil
+	applied, err = serverConfigure(nil, "1", "", 0, "t5000", "", "hourly", "monthly", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"billing_cycle", "monthly_traffic_package"}, applied)
+	assert.Equal(t, []configureServerPostValues{{ID: "1", BillingCycle: "monthly", MonthlyPackage: "t5000"}}, bodies)
+
+	// if the API rejects the combined call the changes are applied one at a time until a change fails
+	bodies = nil
+	failingBodies = map[int]error{1: rejectedErr, 3: rejectedErr}
+	applied, err = serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.EqualError(t, err, "failed to change ram_mb: error response from Kamatera API (400): not supported")
+	assert.Equal(t, []string{"cpu_type", "cpu_cores"}, applied)
+	assert.Equal(t, []configureServerPostValues{
+		{ID: "1", CPU: "4B", RAM: 4096, DailyBackup: "yes"},
+		{ID: "1", CPU: "4B"},
+		{ID: "1", RAM: 4096},
+	}, bodies)
+
+	// if the combined call fails otherwise, only the changes which were not applied are retried
+	bodies = nil
+	failingBodies = map[int]error{1: fmt.Errorf("kamatera command failed")}
+	serverInfo = map[string]interface{}{"cpu": "4B", "ram": 2048.0, "backup": "1", "managed": "0"}
+	applied, err = serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cpu_type", "cpu_cores", "daily_backup", "ram_mb"}, applied)
+	assert.Equal(t, []configureServerPostValues{
+		{ID: "1", CPU: "4B", RAM: 4096, DailyBackup: "yes"},
+		{ID: "1", RAM: 4096},
+	}, bodies)
+
+	// if the server can't be read nothing is retried
+	bodies = nil
+	serverInfo = nil
+	applied, err = serverConfigure(nil, "1", "4B", 4096, "", "", "", "", "yes", "")
+	assert.EqualError(t, err, "failed to configure server: kamatera command failed")
+	assert.Len(t, applied, 0)
+	assert.Len(t, bodies, 1)
+}
+
+func TestServerConfigureStepApplied(t *testing.T) {
+	server := map[string]interface{}{
+		"cpu": "CB", "ram": 8192.0, "billing": "monthly", "traffic": "t5000", "backup": "0", "managed": "1",
+	}
+	assert.True(t, serverConfigureStepApplied(server, configureServerPostValues{CPU: "12B", RAM: 8192}))
+	assert.True(t, serverConfigureStepApplied(server, configureServerPostValues{BillingCycle: "monthly", MonthlyPackage: "t5000"}))
+	assert.True(t, serverConfigureStepApplied(server, configureServerPostValues{DailyBackup: "no", Managed: "yes"}))
+	assert.False(t, serverConfigureStepApplied(server, configureServerPostValues{CPU: "12A"}))
+	assert.False(t, serverConfigureStepApplied(server, configureServerPostValues{RAM: 4096}))
+	assert.False(t, serverConfigureStepApplied(server, configureServerPostValues{DailyBackup: "yes"}))
+	assert.False(t, serverConfigureStepApplied(map[string]interface{}{}, configureServerPostValues{CPU: "2B"}))
+}
+
+func TestResourceServerUpdatePartialState(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+	skipWaiting = true
+	var paths []string
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		paths = append(paths, path)
+		switch path {
+		case "server/configure":
+			return []interface{}{"1"}, nil
+		case "service/server/info":
+			return []interface{}{map[string]interface{}{"cpu": "4B", "ram": 4096.0, "diskSizes": []interface{}{20.0}}}, nil
+		case "server/disk":
+			return nil, fmt.Errorf("disk change failed")
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		skipWaiting = false
+		mockableRequest = prevRequest
+	}()
+
+	state := &terraform.InstanceState{ID: "my-server", Attributes: map[string]string{
+		"id":                 "my-server",
+		"internal_server_id": "1",
+		"name":               "my-server",
+		"datacenter_id":      "EU",
+		"image_id":           "EU:ubuntu",
+		"cpu_type":           "B",
+		"cpu_cores":          "2",
+		"ram_mb":             "2048",
+		"disk_sizes_gb.#":    "1",
+		"disk_sizes_gb.0":    "20",
+		"billing_cycle":      "hourly",
+		"power_on":           "true",
+	}}
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"name":          "my-renamed-server",
+		"datacenter_id": "EU",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     4,
+		"ram_mb":        4096,
+		"disk_sizes_gb": []interface{}{20, 50},
+	})
+	diff, err := resourceServer().Diff(context.Background(), state, config, nil)
+	assert.NoError(t, err)
+	d, err := schema.InternalMap(resourceServer().Schema).Data(state, diff)
+	assert.NoError(t, err)
+
+	diags := resourceServerUpdate(context.Background(), d, &ProviderConfig{})
+	if assert.True(t, diags.HasError()) {
+		assert.Equal(t, "failed to add 50 GB disk: disk change failed", diags[0].Summary)
+	}
+	assert.Equal(t, []string{"server/configure", "service/server/info", "service/server/info", "server/disk"}, paths)
+
+	// the applied configuration is kept, the changes which were not applied keep their previous values
+	newState := d.State()
+	assert.Equal(t, "4", newState.Attributes["cpu_cores"])
+	assert.Equal(t, "4096", newState.Attributes["ram_mb"])
+	assert.Equal(t, "1", newState.Attributes["disk_sizes_gb.#"])
+	assert.Equal(t, "20", newState.Attributes["disk_sizes_gb.0"])
+	assert.Equal(t, "my-server", newState.Attributes["name"])
+}
+
+func TestResourceServerPlanAttributePath(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	ty := resourceServer().CoreConfigSchema().ImpliedType()
+	values := map[string]cty.Value{
+		"name":          cty.StringVal("my-server"),
+		"datacenter_id": cty.StringVal("EU"),
+		"image_id":      cty.StringVal("EU:ubuntu"),
+		"cpu_type":      cty.StringVal("B"),
+		"cpu_cores":     cty.NumberIntVal(2),
+		"ram_mb":        cty.NumberIntVal(3000),
+		"disk_sizes_gb": cty.ListVal([]cty.Value{cty.NumberIntVal(20), cty.NumberIntVal(30)}),
+	}
+	attributes := map[string]cty.Value{}
+	for name, attributeType := range ty.AttributeTypes() {
+		if value, ok := values[name]; ok {
+			attributes[name] = value
+		} else {
+			attributes[name] = cty.NullVal(attributeType)
+		}
+	}
+	config, err := msgpack.Marshal(cty.ObjectVal(attributes), ty)
+	assert.NoError(t, err)
+	priorState, err := msgpack.Marshal(cty.NullVal(ty), ty)
+	assert.NoError(t, err)
+
+	resp, err := schema.NewGRPCProviderServer(Provider()).PlanResourceChange(context.Background(), &tfprotov5.PlanResourceChangeRequest{
+		TypeName:         "kamatera_server",
+		PriorState:       &tfprotov5.DynamicValue{MsgPack: priorState},
+		ProposedNewState: &tfprotov5.DynamicValue{MsgPack: config},
+		Config:           &tfprotov5.DynamicValue{MsgPack: config},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, resp.Diagnostics, 1) {
+		assert.Equal(t, "invalid server configuration: unsupported RAM size for CPU type B: 3000 MB (nearest valid "+
+			"value below: 2048 MB, nearest valid value above: 4096 MB, valid values: 1024, 2048, 4096, 8192), also "+
+			"invalid: disk_sizes_gb[1]: unsupported disk size: 30 GB (nearest valid value below: 20 GB, nearest "+
+			"valid value above: 50 GB, valid values: 5, 10, 20, 50, 100)", resp.Diagnostics[0].Summary)
+		assert.Equal(t, tftypes.NewAttributePath().WithAttributeName("ram_mb"), resp.Diagnostics[0].Attribute)
+	}
+}
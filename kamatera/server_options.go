@@ -3,10 +3,17 @@ package kamatera
 import (
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/tidwall/gjson"
 )
 
@@ -16,23 +23,55 @@ var (
 	loadServerOptionsOnce sync.Once
 )
 
-func _loadServerOptions() (gjson.Result, error) {
-	resp, err := http.Get("https://console.kamatera.com/info/calculator.js.php")
+var serverOptionsUrl = "https://console.kamatera.com/info/calculator.js.php"
+
+func downloadServerOptions() (string, error) {
+	resp, err := http.Get(serverOptionsUrl)
 	if err != nil {
-		return gjson.Result{}, fmt.Errorf("failed to download server options: %w", err)
+		return "", fmt.Errorf("failed to download server options: %w", err)
 	}
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return gjson.Result{}, fmt.Errorf("failed to read response body: %w", err)
+		return "", fmt.Errorf("failed to read response body: %w", err)
 	}
 	parts := strings.Split(string(body), "'")
 	if len(parts) < 3 {
-		return gjson.Result{}, fmt.Errorf("unexpected content format")
+		return "", fmt.Errorf("unexpected content format")
 	}
 	jsonStr := strings.Join(parts[1:len(parts)-1], "'")
 	if !gjson.Valid(jsonStr) {
-		return gjson.Result{}, fmt.Errorf("invalid JSON format in response")
+		return "", fmt.Errorf("invalid JSON format in response")
+	}
+	return jsonStr, nil
+}
+
+// serverOptionsSnapshotPath returns the path of the last downloaded server options, which are used when the
+// server options can't be downloaded. The snapshot is used only if KAMATERA_SERVER_OPTIONS_SNAPSHOT is set.
+func serverOptionsSnapshotPath() string {
+	return os.Getenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT")
+}
+
+func _loadServerOptions() (gjson.Result, error) {
+	snapshotPath := serverOptionsSnapshotPath()
+	jsonStr, err := downloadServerOptions()
+	if err != nil {
+		if snapshotPath == "" {
+			return gjson.Result{}, err
+		}
+		snapshot, snapshotErr := os.ReadFile(snapshotPath)
+		if snapshotErr != nil || !gjson.ValidBytes(snapshot) {
+			return gjson.Result{}, err
+		}
+		log.Printf("[WARN] %s, using server options snapshot %s", err, snapshotPath)
+		return gjson.ParseBytes(snapshot), nil
+	}
+	if snapshotPath != "" {
+		if e := os.MkdirAll(filepath.Dir(snapshotPath), 0755); e != nil {
+			log.Printf("[WARN] failed to create server options snapshot directory: %s", e)
+		} else if e := os.WriteFile(snapshotPath, []byte(jsonStr), 0644); e != nil {
+			log.Printf("[WARN] failed to write server options snapshot: %s", e)
+		}
 	}
 	return gjson.Parse(jsonStr), nil
 }
@@ -44,6 +83,162 @@ func loadServerOptions() error {
 	return serverOptionsErr
 }
 
+type serverOptionsConfig struct {
+	datacenterId          string
+	cpuType               string
+	cpuCores              int
+	ramMB                 int
+	diskSizesGB           []int
+	billingCycle          string
+	monthlyTrafficPackage string
+	dailyBackup           bool
+	managed               bool
+	// imageOs is the OS of the server image, empty if unknown
+	imageOs string
+}
+
+// serverOptionsValidateConfig validates all the server configuration options, returns an error for each invalid option.
+func serverOptionsValidateConfig(config serverOptionsConfig) []error {
+	var errors []error
+	validDatacenter := true
+	if err := serverOptionsValidateDatacenter(config.datacenterId); err != nil {
+		errors = append(errors, err)
+		validDatacenter = false
+	}
+	if err := serverOptionsValidateCpu(fmt.Sprintf("%d%s", config.cpuCores, config.cpuType)); err != nil {
+		errors = append(errors, err)
+	}
+	if validDatacenter && config.imageOs != "" {
+		if err := serverOptionsValidateOsDatacenter(config.datacenterId, config.imageOs); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	if err := serverOptionsValidateRamMB(config.cpuType, config.ramMB); err != nil {
+		errors = append(errors, err)
+	}
+	for i, diskSizeGB := range config.diskSizesGB {
+		if err := serverOptionsValidateDiskSizeGB(diskSizeGB); err != nil {
+			err.(*serverOptionsError).attributePath = cty.GetAttrPath("disk_sizes_gb").IndexInt(i)
+			errors = append(errors, err)
+		}
+	}
+	if config.billingCycle == "monthly" {
+		if err := serverOptionsValidateMonthlyTrafficPackage(config.datacenterId, config.monthlyTrafficPackage); err != nil {
+			errors = append(errors, err)
+		}
+	} else if config.billingCycle != "hourly" {
+		errors = append(errors, &serverOptionsError{
+			attributePath: cty.GetAttrPath("billing_cycle"),
+			summary:       fmt.Sprintf("billing cycle must be either 'hourly' or 'monthly', got '%s'", config.billingCycle),
+		})
+	}
+	return errors
+}
+
+// serverOptionsError is a validation error of a server option, attached to the attribute of the invalid value.
+type serverOptionsError struct {
+	attributePath cty.Path
+	summary       string
+	detail        string
+}
+
+func (e *serverOptionsError) Error() string {
+	message := fmt.Sprintf("%s: %s", attributePathString(e.attributePath), e.summary)
+	if e.detail != "" {
+		message = fmt.Sprintf("%s (%s)", message, e.detail)
+	}
+	return message
+}
+
+func (e *serverOptionsError) Diagnostic() diag.Diagnostic {
+	return diag.Diagnostic{
+		Severity:      diag.Error,
+		Summary:       e.summary,
+		Detail:        e.detail,
+		AttributePath: e.attributePath,
+	}
+}
+
+// serverOptionsPathError returns the server options errors as a single error which is attached to the attribute of
+// the first error, so that Terraform shows it on the configuration line of that attribute.
+func serverOptionsPathError(errors []error) error {
+	first := errors[0].(*serverOptionsError)
+	message := first.summary
+	if first.detail != "" {
+		message = fmt.Sprintf("%s (%s)", message, first.detail)
+	}
+	if len(errors) > 1 {
+		var others []string
+		for _, e := range errors[1:] {
+			others = append(others, e.Error())
+		}
+		message = fmt.Sprintf("%s, also invalid: %s", message, strings.Join(others, ", "))
+	}
+	return first.attributePath.NewErrorf("invalid server configuration: %s", message)
+}
+
+// attributePathString formats an attribute path the same as in the configuration, e.g. disk_sizes_gb[2]
+func attributePathString(path cty.Path) string {
+	var res string
+	for _, step := range path {
+		switch step := step.(type) {
+		case cty.GetAttrStep:
+			if res != "" {
+				res += "."
+			}
+			res += step.Name
+		case cty.IndexStep:
+			if step.Key.Type() == cty.Number {
+				index, _ := step.Key.AsBigFloat().Int64()
+				res += fmt.Sprintf("[%d]", index)
+			} else {
+				res += fmt.Sprintf("[%q]", step.Key.AsString())
+			}
+		}
+	}
+	return res
+}
+
+// maxListedValidValues is the maximum number of valid values to list in validation errors.
+const maxListedValidValues = 12
+
+// validIntValuesDetail describes the valid values nearest to value, and all the valid values for short lists.
+func validIntValuesDetail(values []int, value int, unit string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	var details []string
+	below, above := -1, -1
+	for i, v := range values {
+		if v < value {
+			below = i
+		} else if v > value && above == -1 {
+			above = i
+		}
+	}
+	if below != -1 {
+		details = append(details, fmt.Sprintf("nearest valid value below: %d%s", values[below], unit))
+	}
+	if above != -1 {
+		details = append(details, fmt.Sprintf("nearest valid value above: %d%s", values[above], unit))
+	}
+	if len(values) <= maxListedValidValues {
+		var valueStrings []string
+		for _, v := range values {
+			valueStrings = append(valueStrings, strconv.Itoa(v))
+		}
+		details = append(details, fmt.Sprintf("valid values: %s", strings.Join(valueStrings, ", ")))
+	}
+	return strings.Join(details, ", ")
+}
+
+func validStringValuesDetail(values []string) string {
+	if len(values) == 0 || len(values) > maxListedValidValues {
+		return ""
+	}
+	return fmt.Sprintf("valid values: %s", strings.Join(values, ", "))
+}
+
 func serverOptionsValidateDatacenter(datacenterId string) error {
 	found := false
 	for key, _ := range serverOptions.Map() {
@@ -61,7 +256,11 @@ func serverOptionsValidateDatacenter(datacenterId string) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("unsupported datacenter ID: %s", datacenterId)
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("datacenter_id"),
+			summary:       fmt.Sprintf("unsupported datacenter ID: %s", datacenterId),
+			detail:        validStringValuesDetail(serverOptionsDatacenterIds()),
+		}
 	}
 	return nil
 }
@@ -75,7 +274,29 @@ func serverOptionsValidateCpu(cpu string) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("unsupported CPU: %s", cpu)
+		cpuTypes := serverOptionsCpuTypes()
+		if len(cpu) > 1 {
+			cores, err := strconv.Atoi(cpu[:len(cpu)-1])
+			cpuType := cpu[len(cpu)-1:]
+			for _, t := range cpuTypes {
+				if err == nil && t.cpuType == cpuType {
+					return &serverOptionsError{
+						attributePath: cty.GetAttrPath("cpu_cores"),
+						summary:       fmt.Sprintf("unsupported number of CPU cores for CPU type %s: %d", cpuType, cores),
+						detail:        validIntValuesDetail(t.cores, cores, ""),
+					}
+				}
+			}
+		}
+		var validCpuTypes []string
+		for _, t := range cpuTypes {
+			validCpuTypes = append(validCpuTypes, t.cpuType)
+		}
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("cpu_type"),
+			summary:       fmt.Sprintf("unsupported CPU: %s", cpu),
+			detail:        validStringValuesDetail(validCpuTypes),
+		}
 	}
 	return nil
 }
@@ -89,7 +310,25 @@ func serverOptionsValidateDiskSizeGB(diskSizeGB int) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("unsupported disk size: %d GB", diskSizeGB)
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("disk_sizes_gb"),
+			summary:       fmt.Sprintf("unsupported disk size: %d GB", diskSizeGB),
+			detail:        validIntValuesDetail(serverOptionsDiskSizesGB(), diskSizeGB, " GB"),
+		}
+	}
+	return nil
+}
+
+// validateServerOptionsDiskSizeGB validates a single disk size, attaching the error to the list item.
+// The validation is skipped if the server options can't be loaded, as it's validated again in the plan.
+func validateServerOptionsDiskSizeGB(value interface{}, path cty.Path) diag.Diagnostics {
+	if err := loadServerOptions(); err != nil {
+		return nil
+	}
+	if err := serverOptionsValidateDiskSizeGB(value.(int)); err != nil {
+		optionsError := err.(*serverOptionsError)
+		optionsError.attributePath = path
+		return diag.Diagnostics{optionsError.Diagnostic()}
 	}
 	return nil
 }
@@ -103,11 +342,59 @@ func serverOptionsValidateMonthlyTrafficPackage(datacenterId string, monthlyTraf
 		}
 	}
 	if !found {
-		return fmt.Errorf("unsupported monthly traffic package for %s datacenter: %s", datacenterId, monthlyTrafficPackage)
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("monthly_traffic_package"),
+			summary:       fmt.Sprintf("unsupported monthly traffic package for %s datacenter: %s", datacenterId, monthlyTrafficPackage),
+			detail:        validStringValuesDetail(serverOptionsMonthlyTrafficPackages(datacenterId)),
+		}
+	}
+	return nil
+}
+
+// serverOptionsOsDatacenters returns the datacenters which support the image OS, returns nil if the OS is unknown.
+func serverOptionsOsDatacenters(os string) []string {
+	var datacenters []string
+	for _, option := range serverOptions.Get("os").Array() {
+		if option.Get("value").String() != os {
+			continue
+		}
+		datacenters = []string{}
+		for _, d := range option.Get("datacenters").Array() {
+			datacenters = append(datacenters, d.String())
+		}
+	}
+	sort.Strings(datacenters)
+	return datacenters
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func serverOptionsValidateOsDatacenter(datacenterId string, os string) error {
+	datacenters := serverOptionsOsDatacenters(os)
+	if datacenters != nil && !containsString(datacenters, datacenterId) {
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("image_id"),
+			summary:       fmt.Sprintf("image OS %s is not available in datacenter %s", os, datacenterId),
+			detail:        availableDatacentersDetail(datacenters),
+		}
 	}
 	return nil
 }
 
+func availableDatacentersDetail(datacenters []string) string {
+	if len(datacenters) == 0 {
+		return "not available in any datacenter"
+	}
+	return fmt.Sprintf("available in datacenters: %s", strings.Join(datacenters, ", "))
+}
+
 func serverOptionsValidateRamMB(cpuType string, ramMB int) error {
 	found := false
 	for _, option := range serverOptions.Get(fmt.Sprintf("ramMB\\.%s.0.options", cpuType)).Array() {
@@ -117,7 +404,91 @@ func serverOptionsValidateRamMB(cpuType string, ramMB int) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("unsupported RAM size for CPU type %s: %d MB", cpuType, ramMB)
+		return &serverOptionsError{
+			attributePath: cty.GetAttrPath("ram_mb"),
+			summary:       fmt.Sprintf("unsupported RAM size for CPU type %s: %d MB", cpuType, ramMB),
+			detail:        validIntValuesDetail(serverOptionsRamMB(cpuType), ramMB, " MB"),
+		}
 	}
 	return nil
 }
+
+type serverOptionsCpuType struct {
+	cpuType string
+	cores   []int
+}
+
+// serverOptionsCpuTypes returns the CPU types with the valid number of cores for each type, ordered by CPU type.
+func serverOptionsCpuTypes() []serverOptionsCpuType {
+	var cpuTypes []serverOptionsCpuType
+	coresByType := map[string][]int{}
+	for _, option := range serverOptions.Get("cpu.0.options").Array() {
+		value := option.Get("value").String()
+		if len(value) < 2 {
+			continue
+		}
+		cores, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			continue
+		}
+		cpuType := value[len(value)-1:]
+		if _, ok := coresByType[cpuType]; !ok {
+			cpuTypes = append(cpuTypes, serverOptionsCpuType{cpuType: cpuType})
+		}
+		coresByType[cpuType] = append(coresByType[cpuType], cores)
+	}
+	for i := range cpuTypes {
+		cpuTypes[i].cores = coresByType[cpuTypes[i].cpuType]
+		sort.Ints(cpuTypes[i].cores)
+	}
+	sort.Slice(cpuTypes, func(i, j int) bool {
+		return cpuTypes[i].cpuType < cpuTypes[j].cpuType
+	})
+	return cpuTypes
+}
+
+func serverOptionsIntValues(path string) []int {
+	var values []int
+	for _, option := range serverOptions.Get(path).Array() {
+		values = append(values, int(option.Get("value").Int()))
+	}
+	sort.Ints(values)
+	return values
+}
+
+func serverOptionsRamMB(cpuType string) []int {
+	return serverOptionsIntValues(fmt.Sprintf("ramMB\\.%s.0.options", cpuType))
+}
+
+func serverOptionsDiskSizesGB() []int {
+	return serverOptionsIntValues("diskGB.0.options")
+}
+
+func serverOptionsMonthlyTrafficPackages(datacenterId string) []string {
+	var packages []string
+	for _, option := range serverOptions.Get(fmt.Sprintf("netPck\\.%s.0.options", datacenterId)).Array() {
+		packages = append(packages, option.Get("value").String())
+	}
+	return packages
+}
+
+// serverOptionsDatacenterIds returns the datacenters which have server options, ordered by datacenter ID.
+func serverOptionsDatacenterIds() []string {
+	found := map[string]bool{}
+	for key := range serverOptions.Map() {
+		if strings.HasPrefix(key, "netPck.") {
+			found[strings.TrimPrefix(key, "netPck.")] = true
+		}
+	}
+	for _, os := range serverOptions.Get("os").Array() {
+		for _, d := range os.Get("datacenters").Array() {
+			found[d.String()] = true
+		}
+	}
+	var datacenterIds []string
+	for datacenterId := range found {
+		datacenterIds = append(datacenterIds, datacenterId)
+	}
+	sort.Strings(datacenterIds)
+	return datacenterIds
+}
@@ -1,7 +1,17 @@
 package kamatera
 
 import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/tidwall/gjson"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -69,3 +79,219 @@ func TestServerOptionsValidateRamMb(t *testing.T) {
 		assert.Error(t, serverOptionsValidateRamMB("D", ram), "RAM validation should fail for: %d MB", ram)
 	}
 }
+
+// testServerOptionsJSON is a hand written subset of the calculator data. The price fields are not taken from a
+// calculator snapshot, TestServerOptionsEstimatePriceDownloaded checks them against the downloaded calculator data.
+const testServerOptionsJSON = `{
+	"cpu": [{"options": [
+		{"value": "1A"}, {"value": "2A"}, {"value": "1B"},
+		{"value": "2B", "priceMonthly": 8, "priceHourlyOn": 0.011, "priceHourlyOff": 0},
+		{"value": "4B", "priceMonthly": 16, "priceHourlyOn": 0.022, "priceHourlyOff": 0},
+		{"value": "8B"}, {"value": "2T"}, {"value": "4T"}, {"value": "2D"}, {"value": "8D"}
+	]}],
+	"ramMB.A": [{"options": [{"value": 256}, {"value": 512}, {"value": 1024}]}],
+	"ramMB.B": [{"options": [
+		{"value": 1024},
+		{"value": 2048, "priceMonthly": 10, "priceHourlyOn": 0.014, "priceHourlyOff": 0},
+		{"value": 4096, "priceMonthly": 20, "priceHourlyOn": 0.028, "priceHourlyOff": 0},
+		{"value": 8192}
+	]}],
+	"ramMB.T": [{"options": [{"value": 2048}, {"value": 4096}]}],
+	"ramMB.D": [{"options": [{"value": 4096}, {"value": 8192}]}],
+	"diskGB": [{"options": [
+		{"value": 5},
+		{"value": 10},
+		{"value": 20, "priceMonthly": 2, "priceHourlyOn": 0.003, "priceHourlyOff": 0.003},
+		{"value": 50, "priceMonthly": 5, "priceHourlyOn": 0.007, "priceHourlyOff": 0.007},
+		{"value": 100}
+	]}],
+	"netPck.EU": [{"options": [{"value": "t5000", "priceMonthly": 0, "priceHourlyOn": 0, "priceHourlyOff": 0}, {"value": "b50"}]}],
+	"netPck.US-NY2": [{"options": [{"value": "t5000"}]}],
+	"dailyBackup": [{"options": [{"value": "yes", "priceMonthly": 3, "priceHourlyOn": 0.004, "priceHourlyOff": 0.004}]}],
+	"managed": [{"options": [{"value": "yes", "priceMonthly": 50, "priceHourlyOn": 0.069, "priceHourlyOff": 0}]}],
+	"os": [
+		{"value": "Ubuntu", "datacenters": ["EU", "US-NY2", "IL"]},
+		{"value": "Windows", "datacenters": ["EU"]}
+	]
+}`
+
+// setTestServerOptions replaces the downloaded server options with the given JSON for the duration of the test
+func setTestServerOptions(t *testing.T, json string) {
+	prevServerOptions, prevServerOptionsErr := serverOptions, serverOptionsErr
+	loadServerOptionsOnce = sync.Once{}
+	loadServerOptionsOnce.Do(func() {
+		serverOptions, serverOptionsErr = gjson.Parse(json), nil
+	})
+	t.Cleanup(func() {
+		serverOptions, serverOptionsErr = prevServerOptions, prevServerOptionsErr
+		loadServerOptionsOnce = sync.Once{}
+	})
+}
+
+func TestServerOptionsValues(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+	assert.Equal(t, []serverOptionsCpuType{
+		{cpuType: "A", cores: []int{1, 2}},
+		{cpuType: "B", cores: []int{1, 2, 4, 8}},
+		{cpuType: "D", cores: []int{2, 8}},
+		{cpuType: "T", cores: []int{2, 4}},
+	}, serverOptionsCpuTypes())
+	assert.Equal(t, []int{1024, 2048, 4096, 8192}, serverOptionsRamMB("B"))
+	assert.Len(t, serverOptionsRamMB("X"), 0)
+	assert.Equal(t, []int{5, 10, 20, 50, 100}, serverOptionsDiskSizesGB())
+	assert.Equal(t, []string{"t5000", "b50"}, serverOptionsMonthlyTrafficPackages("EU"))
+	assert.Equal(t, []string{"EU", "IL", "US-NY2"}, serverOptionsDatacenterIds())
+}
+
+func TestServerOptionsValidateErrors(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	err := serverOptionsValidateRamMB("B", 3000).(*serverOptionsError)
+	assert.Equal(t, cty.GetAttrPath("ram_mb"), err.attributePath)
+	assert.Equal(t, "unsupported RAM size for CPU type B: 3000 MB", err.summary)
+	assert.Equal(t, "nearest valid value below: 2048 MB, nearest valid value above: 4096 MB, "+
+		"valid values: 1024, 2048, 4096, 8192", err.detail)
+
+	err = serverOptionsValidateCpu("3B").(*serverOptionsError)
+	assert.Equal(t, cty.GetAttrPath("cpu_cores"), err.attributePath)
+	assert.Equal(t, "nearest valid value below: 2, nearest valid value above: 4, valid values: 1, 2, 4, 8", err.detail)
+
+	err = serverOptionsValidateCpu("2C").(*serverOptionsError)
+	assert.Equal(t, cty.GetAttrPath("cpu_type"), err.attributePath)
+	assert.Equal(t, "valid values: A, B, D, T", err.detail)
+
+	err = serverOptionsValidateDiskSizeGB(200).(*serverOptionsError)
+	assert.Equal(t, "nearest valid value below: 100 GB, valid values: 5, 10, 20, 50, 100", err.detail)
+
+	errors := serverOptionsValidateConfig(serverOptionsConfig{
+		datacenterId: "EU",
+		cpuType:      "B",
+		cpuCores:     2,
+		ramMB:        2048,
+		diskSizesGB:  []int{20, 50, 30},
+		billingCycle: "hourly",
+	})
+	if assert.Len(t, errors, 1) {
+		assert.Equal(t, "disk_sizes_gb[2]: unsupported disk size: 30 GB (nearest valid value below: 20 GB, "+
+			"nearest valid value above: 50 GB, valid values: 5, 10, 20, 50, 100)", errors[0].Error())
+		diagnostic := errors[0].(*serverOptionsError).Diagnostic()
+		assert.Equal(t, cty.GetAttrPath("disk_sizes_gb").IndexInt(2), diagnostic.AttributePath)
+	}
+
+	diags := validateServerOptionsDiskSizeGB(30, cty.GetAttrPath("disk_sizes_gb").IndexInt(1))
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, cty.GetAttrPath("disk_sizes_gb").IndexInt(1), diags[0].AttributePath)
+	}
+	assert.Len(t, validateServerOptionsDiskSizeGB(50, cty.GetAttrPath("disk_sizes_gb").IndexInt(1)), 0)
+}
+
+func TestServerOptionsValidateAvailability(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	config := serverOptionsConfig{
+		datacenterId: "US-NY2",
+		cpuType:      "D",
+		cpuCores:     2,
+		ramMB:        4096,
+		diskSizesGB:  []int{20},
+		billingCycle: "hourly",
+		imageOs:      "Windows",
+	}
+	errors := serverOptionsValidateConfig(config)
+	if assert.Len(t, errors, 1) {
+		assert.Equal(t, "image_id: image OS Windows is not available in datacenter US-NY2 (available in datacenters: EU)", errors[0].Error())
+	}
+
+	config.datacenterId = "EU"
+	assert.Len(t, serverOptionsValidateConfig(config), 0)
+
+	// unknown OS is available in all datacenters
+	config.datacenterId, config.imageOs = "US-NY2", "FreeBSD"
+	assert.Len(t, serverOptionsValidateConfig(config), 0)
+}
+
+func TestLoadServerOptionsSnapshot(t *testing.T) {
+	snapshotPath := filepath.Join(t.TempDir(), "server_options.json")
+	t.Setenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT", snapshotPath)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "var calculatorOptions = '%s';", testServerOptionsJSON)
+	}))
+	prevServerOptionsUrl := serverOptionsUrl
+	serverOptionsUrl = server.URL
+	defer func() {
+		serverOptionsUrl = prevServerOptionsUrl
+	}()
+
+	options, err := _loadServerOptions()
+	assert.NoError(t, err)
+	assert.Equal(t, "2B", options.Get("cpu.0.options.3.value").String())
+	assert.FileExists(t, snapshotPath)
+
+	// failing to write the snapshot doesn't fail loading the server options
+	t.Setenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT", filepath.Join(snapshotPath, "server_options.json"))
+	_, err = _loadServerOptions()
+	assert.NoError(t, err)
+
+	server.Close()
+	t.Setenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT", snapshotPath)
+	options, err = _loadServerOptions()
+	assert.NoError(t, err, "Expected server options to load from snapshot")
+	assert.Equal(t, "2B", options.Get("cpu.0.options.3.value").String())
+
+	// the snapshot is used only when it is configured
+	t.Setenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT", "")
+	_, err = _loadServerOptions()
+	assert.Error(t, err)
+
+	t.Setenv("KAMATERA_SERVER_OPTIONS_SNAPSHOT", snapshotPath)
+	assert.NoError(t, os.Remove(snapshotPath))
+	_, err = _loadServerOptions()
+	assert.Error(t, err)
+}
+
+func TestResourceServerCustomizeDiffAvailability(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+	prevRequest := mockableRequest
+	mockableRequest = func(provider *ProviderConfig, method string, path string, body interface{}) (interface{}, error) {
+		switch path {
+		case "service/server?images=1&datacenter=US-NY2":
+			return []interface{}{
+				map[string]interface{}{"id": "US-NY2:windows", "os": "Windows", "code": "2022", "name": "Windows 2022"},
+			}, nil
+		case "service/hdlib?private=1":
+			return []interface{}{
+				map[string]interface{}{"name": nil, "datacenter": "US-NY2", "os": nil},
+			}, nil
+		}
+		return nil, fmt.Errorf("unexpected request: %s", path)
+	}
+	defer func() {
+		mockableRequest = prevRequest
+	}()
+
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"datacenter_id": "US-NY2",
+		"image_id":      "US-NY2:windows",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20},
+	}
+	provider := &ProviderConfig{catalogCache: newCatalogCache()}
+	_, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), provider)
+	if assert.Error(t, err) {
+		assert.Equal(t, "invalid server configuration: image OS Windows is not available in datacenter US-NY2 "+
+			"(available in datacenters: EU)", err.Error())
+		assert.Equal(t, cty.GetAttrPath("image_id"), err.(cty.PathError).Path)
+	}
+
+	config["image_id"] = "US-NY2:unknown"
+	_, err = resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), provider)
+	assert.NoError(t, err)
+
+	// the availability is not checked if the images can't be listed
+	config["datacenter_id"], config["image_id"] = "EU", "EU:windows"
+	_, err = resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), provider)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,100 @@
+package kamatera
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// errServerPriceUnavailable is returned when the calculator options don't include prices. The calculator price
+// fields are not documented, so prices are only estimated when the expected fields exist.
+var errServerPriceUnavailable = errors.New("server price is not available in the calculator data")
+
+type serverPrice struct {
+	monthlyOn float64
+	hourlyOn  float64
+	hourlyOff float64
+}
+
+func (p serverPrice) add(other serverPrice) serverPrice {
+	return serverPrice{
+		monthlyOn: p.monthlyOn + other.monthlyOn,
+		hourlyOn:  p.hourlyOn + other.hourlyOn,
+		hourlyOff: p.hourlyOff + other.hourlyOff,
+	}
+}
+
+type serverPriceComponent struct {
+	name  string
+	price serverPrice
+}
+
+// serverOptionPrice finds the option with the given value and returns its price. Calculator options include
+// the monthly price and the hourly prices when the server is on and off.
+func serverOptionPrice(path string, value string) (serverPrice, error) {
+	for _, option := range serverOptions.Get(path).Array() {
+		if option.Get("value").String() != value {
+			continue
+		}
+		var missing []string
+		for _, key := range []string{"priceMonthly", "priceHourlyOn", "priceHourlyOff"} {
+			if !option.Get(key).Exists() {
+				missing = append(missing, key)
+			}
+		}
+		if len(missing) > 0 {
+			return serverPrice{}, fmt.Errorf("%w: missing price for %s: calculator option has no %s",
+				errServerPriceUnavailable, value, strings.Join(missing, ", "))
+		}
+		return serverPrice{
+			monthlyOn: option.Get("priceMonthly").Float(),
+			hourlyOn:  option.Get("priceHourlyOn").Float(),
+			hourlyOff: option.Get("priceHourlyOff").Float(),
+		}, nil
+	}
+	return serverPrice{}, fmt.Errorf("unsupported value %s", value)
+}
+
+// serverOptionsEstimatePrice estimates the server price from the calculator pricing data.
+// Returns the total price and the price of each component which makes up the total.
+func serverOptionsEstimatePrice(config serverOptionsConfig) (serverPrice, []serverPriceComponent, error) {
+	type componentOption struct {
+		name  string
+		path  string
+		value string
+	}
+	options := []componentOption{
+		{"cpu", "cpu.0.options", fmt.Sprintf("%d%s", config.cpuCores, config.cpuType)},
+		{"ram", fmt.Sprintf("ramMB\\.%s.0.options", config.cpuType), strconv.Itoa(config.ramMB)},
+	}
+	for i, diskSizeGB := range config.diskSizesGB {
+		options = append(options, componentOption{fmt.Sprintf("disk_%d", i), "diskGB.0.options", strconv.Itoa(diskSizeGB)})
+	}
+	if config.billingCycle == "monthly" {
+		options = append(options, componentOption{"traffic", fmt.Sprintf("netPck\\.%s.0.options", config.datacenterId), config.monthlyTrafficPackage})
+	}
+	if config.dailyBackup {
+		options = append(options, componentOption{"daily_backup", "dailyBackup.0.options", "yes"})
+	}
+	if config.managed {
+		options = append(options, componentOption{"managed", "managed.0.options", "yes"})
+	}
+
+	var total serverPrice
+	var components []serverPriceComponent
+	for _, option := range options {
+		price, err := serverOptionPrice(option.path, option.value)
+		if err != nil {
+			return serverPrice{}, nil, fmt.Errorf("failed to estimate %s price: %w", option.name, err)
+		}
+		components = append(components, serverPriceComponent{name: option.name, price: price})
+		total = total.add(price)
+	}
+	return total, components, nil
+}
+
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(math.Round(price*10000)/10000, 'f', -1, 64)
+}
@@ -0,0 +1,159 @@
+package kamatera
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerOptionsEstimatePrice(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	price, components, err := serverOptionsEstimatePrice(serverOptionsConfig{
+		datacenterId:          "EU",
+		cpuType:               "B",
+		cpuCores:              2,
+		ramMB:                 2048,
+		diskSizesGB:           []int{20, 50},
+		billingCycle:          "monthly",
+		monthlyTrafficPackage: "t5000",
+		dailyBackup:           true,
+		managed:               true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "78", formatPrice(price.monthlyOn))
+	assert.Equal(t, "0.108", formatPrice(price.hourlyOn))
+	assert.Equal(t, "0.014", formatPrice(price.hourlyOff))
+	var names []string
+	for _, component := range components {
+		names = append(names, component.name)
+	}
+	assert.Equal(t, []string{"cpu", "ram", "disk_0", "disk_1", "traffic", "daily_backup", "managed"}, names)
+
+	price, components, err = serverOptionsEstimatePrice(serverOptionsConfig{
+		datacenterId: "EU",
+		cpuType:      "B",
+		cpuCores:     4,
+		ramMB:        4096,
+		diskSizesGB:  []int{20},
+		billingCycle: "hourly",
+	})
+	assert.NoError(t, err)
+	assert.Len(t, components, 3)
+	assert.Equal(t, "38", formatPrice(price.monthlyOn))
+	assert.Equal(t, "0.053", formatPrice(price.hourlyOn))
+	assert.Equal(t, "0.003", formatPrice(price.hourlyOff))
+
+	_, _, err = serverOptionsEstimatePrice(serverOptionsConfig{
+		datacenterId: "EU",
+		cpuType:      "B",
+		cpuCores:     8,
+		ramMB:        2048,
+		diskSizesGB:  []int{20},
+		billingCycle: "hourly",
+	})
+	assert.EqualError(t, err, "failed to estimate cpu price: server price is not available in the calculator data: missing price for 8B: calculator option has no priceMonthly, priceHourlyOn, priceHourlyOff")
+
+	setTestServerOptions(t, `{"diskGB": [{"options": [{"value": 30, "priceMonthly": 3}]}]}`)
+	_, err = serverOptionPrice("diskGB.0.options", "30")
+	assert.ErrorIs(t, err, errServerPriceUnavailable)
+	assert.EqualError(t, err, "server price is not available in the calculator data: missing price for 30: calculator option has no priceHourlyOn, priceHourlyOff")
+}
+
+// TestServerOptionsEstimatePriceDownloaded verifies that the downloaded calculator data has the price fields which
+// are used in the price estimation, the test server options only mimic these fields.
+func TestServerOptionsEstimatePriceDownloaded(t *testing.T) {
+	err := loadServerOptions()
+	if err != nil {
+		t.Fatalf("Failed to load server options: %v", err)
+	}
+	price, _, err := serverOptionsEstimatePrice(serverOptionsConfig{
+		datacenterId:          "EU",
+		cpuType:               "B",
+		cpuCores:              2,
+		ramMB:                 2048,
+		diskSizesGB:           []int{20},
+		billingCycle:          "monthly",
+		monthlyTrafficPackage: "t5000",
+	})
+	if assert.NoError(t, err) {
+		assert.Greater(t, price.monthlyOn, 0.0)
+		assert.Greater(t, price.hourlyOn, 0.0)
+	}
+}
+
+func TestResourceServerCustomizeDiffPrice(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	config := map[string]interface{}{
+		"name":          "my-server",
+		"datacenter_id": "EU",
+		"image_id":      "EU:ubuntu",
+		"cpu_type":      "B",
+		"cpu_cores":     2,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20},
+	}
+	diff, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "20", diff.Attributes["price_monthly_on"].New)
+	assert.Equal(t, "0.028", diff.Attributes["price_hourly_on"].New)
+	assert.Equal(t, "0.003", diff.Attributes["price_hourly_off"].New)
+
+	config["cpu_cores"] = 8
+	diff, err = resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.True(t, diff.Attributes["price_monthly_on"].NewComputed)
+}
+
+func TestDataSourceServerPriceRead(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	d := schema.TestResourceDataRaw(t, dataSourceServerPrice().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20, 50},
+		"billing_cycle": "monthly",
+		"daily_backup":  true,
+	})
+	diags := dataSourceServerPriceRead(context.Background(), d, nil)
+	assert.False(t, diags.HasError(), "Unexpected errors: %v", diags)
+	assert.Equal(t, "t5000", d.Get("monthly_traffic_package"))
+	assert.Equal(t, "28", d.Get("price_monthly_on"))
+	assert.Equal(t, "0.039", d.Get("price_hourly_on"))
+	assert.Equal(t, "0.014", d.Get("price_hourly_off"))
+	assert.Equal(t, 6, d.Get("breakdown.#"))
+	assert.Equal(t, "disk_1", d.Get("breakdown.3.component"))
+	assert.Equal(t, "5", d.Get("breakdown.3.price_monthly_on"))
+
+	d = schema.TestResourceDataRaw(t, dataSourceServerPrice().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"ram_mb":        3000,
+		"disk_sizes_gb": []interface{}{20},
+	})
+	diags = dataSourceServerPriceRead(context.Background(), d, nil)
+	assert.True(t, diags.HasError())
+	assert.Equal(t, "unsupported RAM size for CPU type B: 3000 MB", diags[0].Summary)
+	assert.Equal(t, cty.GetAttrPath("ram_mb"), diags[0].AttributePath)
+
+	// a valid configuration without prices in the pricing data is read with empty prices
+	d = schema.TestResourceDataRaw(t, dataSourceServerPrice().Schema, map[string]interface{}{
+		"datacenter_id": "EU",
+		"cpu_cores":     8,
+		"ram_mb":        2048,
+		"disk_sizes_gb": []interface{}{20},
+	})
+	diags = dataSourceServerPriceRead(context.Background(), d, nil)
+	if assert.Len(t, diags, 1) {
+		assert.Equal(t, diag.Warning, diags[0].Severity)
+		assert.Equal(t, "the server price can't be estimated", diags[0].Summary)
+	}
+	assert.Equal(t, "EU", d.Id())
+	assert.Equal(t, "", d.Get("price_monthly_on"))
+	assert.Equal(t, 0, d.Get("breakdown.#"))
+}
@@ -0,0 +1,98 @@
+package kamatera
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+var startupScriptVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// renderStartupScript replaces each ${name} in the script with the value of the variable with the same name,
+// expressions which don't match a variable, such as shell variables, are left as is.
+func renderStartupScript(script string, vars map[string]interface{}) string {
+	if len(vars) == 0 {
+		return script
+	}
+	return startupScriptVarRegexp.ReplaceAllStringFunc(script, func(expression string) string {
+		name := startupScriptVarRegexp.FindStringSubmatch(expression)[1]
+		if value, ok := vars[name]; ok {
+			return value.(string)
+		}
+		return expression
+	})
+}
+
+func startupScriptSha256(script string) string {
+	if script == "" {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(hash[:])
+}
+
+// startupScriptStateFunc stores the digest of the inline startup script in the state instead of the script.
+func startupScriptStateFunc(v interface{}) string {
+	return startupScriptSha256(v.(string))
+}
+
+// startupScriptDiffSuppressFunc suppresses the difference between the script stored in the state of servers created
+// before the digest was stored and the digest of the same script.
+func startupScriptDiffSuppressFunc(k, old, new string, d *schema.ResourceData) bool {
+	return old != "" && startupScriptSha256(old) == new
+}
+
+type resourceGetter interface {
+	Get(key string) interface{}
+}
+
+// getServerStartupScript returns the server startup script from startup_script or startup_script_file,
+// after substituting the startup_script_vars.
+func getServerStartupScript(d resourceGetter) (string, error) {
+	script := d.Get("startup_script").(string)
+	if path := d.Get("startup_script_file").(string); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read startup_script_file: %w", err)
+		}
+		script = string(content)
+	}
+	return renderStartupScript(script, d.Get("startup_script_vars").(map[string]interface{})), nil
+}
+
+// resourceServerCustomizeDiffStartupScript validates the startup script and sets its digest in the plan, so that
+// changes to the script show as a digest change. A change of the digest of an existing server replaces the server.
+func resourceServerCustomizeDiffStartupScript(d *schema.ResourceDiff) error {
+	for _, key := range []string{"startup_script", "startup_script_file", "startup_script_vars"} {
+		if !d.NewValueKnown(key) {
+			if err := d.SetNewComputed("startup_script_sha256"); err != nil {
+				return err
+			}
+			if d.Id() != "" {
+				return d.ForceNew("startup_script_sha256")
+			}
+			return nil
+		}
+	}
+	script, err := getServerStartupScript(d)
+	if err != nil {
+		return err
+	}
+	o, _ := d.GetChange("startup_script_sha256")
+	sha256 := startupScriptSha256(script)
+	if sha256 == o.(string) {
+		return nil
+	}
+	if err := d.SetNew("startup_script_sha256", sha256); err != nil {
+		return err
+	}
+	// servers created before the digest was added have an empty digest, which is set without replacing the server
+	if d.Id() != "" && o.(string) != "" {
+		return d.ForceNew("startup_script_sha256")
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package kamatera
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderStartupScript(t *testing.T) {
+	script := "#!/bin/bash\necho ${greeting} ${name} > $HOME/hello\necho ${PATH} ${missing}\n"
+	assert.Equal(t, script, renderStartupScript(script, nil))
+	assert.Equal(t,
+		"#!/bin/bash\necho hello world > $HOME/hello\necho ${PATH} ${missing}\n",
+		renderStartupScript(script, map[string]interface{}{"greeting": "hello", "name": "world"}),
+	)
+}
+
+func TestGetServerStartupScript(t *testing.T) {
+	scriptFile := filepath.Join(t.TempDir(), "startup.sh")
+	assert.NoError(t, os.WriteFile(scriptFile, []byte("echo ${name}"), 0600))
+
+	d := schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{
+		"startup_script_file": scriptFile,
+		"startup_script_vars": map[string]interface{}{"name": "my-server"},
+	})
+	script, err := getServerStartupScript(d)
+	assert.NoError(t, err)
+	assert.Equal(t, "echo my-server", script)
+
+	d = schema.TestResourceDataRaw(t, resourceServer().Schema, map[string]interface{}{
+		"startup_script_file": filepath.Join(t.TempDir(), "missing.sh"),
+	})
+	_, err = getServerStartupScript(d)
+	assert.ErrorContains(t, err, "failed to read startup_script_file")
+
+	assert.Equal(t, "", startupScriptSha256(""))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", startupScriptSha256("hello"))
+}
+
+func TestResourceServerCustomizeDiffStartupScript(t *testing.T) {
+	setTestServerOptions(t, testServerOptionsJSON)
+
+	config := map[string]interface{}{
+		"name":           "my-server",
+		"datacenter_id":  "EU",
+		"image_id":       "EU:ubuntu",
+		"cpu_type":       "B",
+		"cpu_cores":      2,
+		"ram_mb":         2048,
+		"disk_sizes_gb":  []interface{}{20},
+		"startup_script": "hello",
+	}
+	diff, err := resourceServer().Diff(context.Background(), nil, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, startupScriptSha256("hello"), diff.Attributes["startup_script_sha256"].New)
+	// the inline script is stored as its digest
+	assert.Equal(t, startupScriptSha256("hello"), diff.Attributes["startup_script"].New)
+
+	stateAttributes := map[string]string{
+		"id":              "my-server",
+		"name":            "my-server",
+		"datacenter_id":   "EU",
+		"image_id":        "EU:ubuntu",
+		"cpu_type":        "B",
+		"cpu_cores":       "2",
+		"ram_mb":          "2048",
+		"disk_sizes_gb.#": "1",
+		"disk_sizes_gb.0": "20",
+		"billing_cycle":   "hourly",
+		"power_on":        "true",
+	}
+	// the inline script shows only as a digest change, servers which stored the script in the state are not replaced
+	for _, stateScript := range []string{startupScriptSha256("hello"), "hello"} {
+		stateAttributes["startup_script"] = stateScript
+		stateAttributes["startup_script_sha256"] = startupScriptSha256("hello")
+		diff, err = resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+		assert.NoError(t, err)
+		if diff != nil {
+			assert.Nil(t, diff.Attributes["startup_script"])
+			assert.False(t, diff.RequiresNew())
+		}
+	}
+	config["startup_script"] = "hello world"
+	diff, err = resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, startupScriptSha256("hello world"), diff.Attributes["startup_script"].New)
+	assert.True(t, diff.RequiresNew())
+	d, err := schema.InternalMap(resourceServer().Schema).Data(&terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, diff)
+	assert.NoError(t, err)
+	script, err := getServerStartupScript(d)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", script)
+	delete(stateAttributes, "startup_script")
+
+	scriptFile := filepath.Join(t.TempDir(), "startup.sh")
+	assert.NoError(t, os.WriteFile(scriptFile, []byte("hello"), 0600))
+	delete(config, "startup_script")
+	config["startup_script_file"] = scriptFile
+
+	// the same script from a file doesn't change the digest
+	stateAttributes["startup_script_sha256"] = startupScriptSha256("hello")
+	diff, err = resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Nil(t, diff.Attributes["startup_script_sha256"])
+	assert.False(t, diff.RequiresNew())
+
+	// servers without a digest get the digest without being replaced
+	stateAttributes["startup_script_sha256"] = ""
+	diff, err = resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, startupScriptSha256("hello"), diff.Attributes["startup_script_sha256"].New)
+	assert.False(t, diff.RequiresNew())
+
+	// changing the script content replaces the server
+	stateAttributes["startup_script_sha256"] = startupScriptSha256("hello")
+	assert.NoError(t, os.WriteFile(scriptFile, []byte("hello ${name}"), 0600))
+	config["startup_script_vars"] = map[string]interface{}{"name": "world"}
+	diff, err = resourceServer().Diff(context.Background(), &terraform.InstanceState{ID: "my-server", Attributes: stateAttributes}, terraform.NewResourceConfigRaw(config), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, startupScriptSha256("hello world"), diff.Attributes["startup_script_sha256"].New)
+	assert.True(t, diff.RequiresNew())
+}